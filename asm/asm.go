@@ -0,0 +1,282 @@
+// Package asm is a two-pass assembler for SIC/XE programs.
+package asm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/obj"
+	oc "github.com/uroshercog/sic-machine/opcodes"
+)
+
+// Directives
+const (
+	dirStart  = "START"
+	dirEnd    = "END"
+	dirByte   = "BYTE"
+	dirWord   = "WORD"
+	dirResb   = "RESB"
+	dirResw   = "RESW"
+	dirBase   = "BASE"
+	dirNobase = "NOBASE"
+)
+
+// Error is an error on a line of the source
+type Error struct {
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// ErrorList is the list of all errors found in the source
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Line is an assembled line of the source
+type Line struct {
+	Number int
+	// Address of the line, -1 for lines that do not occupy memory
+	Address int32
+	// Number of bytes reserved or generated by the line
+	Size   int32
+	Code   []byte
+	Source string
+
+	st *statement
+}
+
+// Program is an assembled program
+type Program struct {
+	Name    string
+	Start   int32
+	Length  int32
+	Entry   int32
+	Lines   []*Line
+	Symbols map[string]int32
+	// Fields holding addresses of the program, which the loader relocates
+	Modifications []*obj.Modification
+}
+
+type assembler struct {
+	program *Program
+	errors  ErrorList
+	base    int32
+	hasBase bool
+	entry   string
+}
+
+// Assemble assembles the SIC/XE source. All errors are collected and returned as an ErrorList.
+func Assemble(r io.Reader) (*Program, error) {
+	a := &assembler{
+		program: &Program{Symbols: map[string]int32{}},
+	}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		a.program.Lines = append(a.program.Lines, &Line{
+			Number:  n,
+			Address: -1,
+			Source:  scanner.Text(),
+			st:      parseLine(scanner.Text()),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	a.pass1()
+	if len(a.errors) == 0 {
+		a.pass2()
+	}
+
+	if len(a.errors) > 0 {
+		return a.program, a.errors
+	}
+	return a.program, nil
+}
+
+func (a *assembler) errorf(line *Line, format string, args ...interface{}) {
+	a.errors = append(a.errors, &Error{line.Number, fmt.Sprintf(format, args...)})
+}
+
+// Pass 1 assigns addresses to all lines and builds the symbol table
+func (a *assembler) pass1() {
+	loc := int32(0)
+	started := false
+
+	for _, line := range a.program.Lines {
+		st := line.st
+		if st == nil {
+			continue
+		}
+
+		if st.op == dirStart {
+			if started {
+				a.errorf(line, "START must be the first statement")
+				continue
+			}
+
+			start, err := strconv.ParseInt(st.operand, 16, 32)
+			if err != nil {
+				a.errorf(line, "Invalid start address %q", st.operand)
+			}
+			loc = int32(start)
+			a.program.Name = st.label
+			a.program.Start = loc
+			line.Address = loc
+		}
+		started = true
+
+		if st.label != "" {
+			if !isSymbol(st.label) {
+				a.errorf(line, "Invalid symbol %q", st.label)
+			} else if _, ok := a.program.Symbols[st.label]; ok {
+				a.errorf(line, "Duplicate symbol %q", st.label)
+			} else {
+				a.program.Symbols[st.label] = loc
+			}
+		}
+
+		switch st.op {
+		case dirStart:
+			continue
+		case "":
+			a.errorf(line, "Missing operation")
+		case dirEnd:
+			a.entry = st.operand
+			line.Address = -1
+			continue
+		case dirBase, dirNobase:
+			continue
+		case dirByte:
+			code, err := parseByte(st.operand)
+			if err != nil {
+				a.errorf(line, "%v", err)
+			}
+			line.Size = int32(len(code))
+		case dirWord:
+			line.Size = 3
+		case dirResb, dirResw:
+			count, err := strconv.ParseInt(st.operand, 10, 32)
+			if err != nil || count < 0 {
+				a.errorf(line, "Invalid size %q", st.operand)
+			}
+			line.Size = int32(count)
+			if st.op == dirResw {
+				line.Size *= 3
+			}
+		default:
+			op, ok := oc.Table[st.op]
+			if !ok {
+				a.errorf(line, "Unknown operation %q", st.op)
+				continue
+			}
+
+			line.Size = int32(op.Format)
+			if st.extended {
+				if op.Format != 3 {
+					a.errorf(line, "%s cannot be extended", op.Mnemonic)
+				}
+				line.Size = 4
+			}
+		}
+
+		line.Address = loc
+		loc += line.Size
+	}
+
+	a.program.Length = loc - a.program.Start
+}
+
+// Pass 2 generates the code of every line
+func (a *assembler) pass2() {
+	a.program.Entry = a.program.Start
+	for _, line := range a.program.Lines {
+		st := line.st
+		if st == nil {
+			continue
+		}
+
+		switch st.op {
+		case dirStart, dirResb, dirResw:
+		case dirEnd:
+			if a.entry != "" {
+				if v, err := a.eval(a.entry, line.Address); err != nil {
+					a.errorf(line, "%v", err)
+				} else {
+					a.program.Entry = v.value
+				}
+			}
+		case dirBase:
+			if v, err := a.eval(st.operand, line.Address); err != nil {
+				a.errorf(line, "%v", err)
+			} else {
+				a.base = v.value
+				a.hasBase = true
+			}
+		case dirNobase:
+			a.hasBase = false
+		case dirByte:
+			line.Code, _ = parseByte(st.operand)
+		case dirWord:
+			if v, err := a.eval(st.operand, line.Address); err != nil {
+				a.errorf(line, "%v", err)
+			} else {
+				line.Code = []byte{byte(v.value >> 16), byte(v.value >> 8), byte(v.value)}
+				if v.relative {
+					a.relocate(line.Address, 6)
+				}
+			}
+		default:
+			code, err := a.encode(line)
+			if err != nil {
+				a.errorf(line, "%v", err)
+			}
+			line.Code = code
+		}
+	}
+}
+
+// Adds an M record for the field of length half-bytes that ends at the last
+// byte of addr..addr+(length+1)/2-1 and holds an address of the program
+func (a *assembler) relocate(addr int32, length int32) {
+	a.program.Modifications = append(a.program.Modifications, &obj.Modification{
+		Addr:   addr - a.program.Start,
+		Length: length,
+		Sign:   '+',
+	})
+}
+
+// Parses the operand of BYTE, either C'characters' or X'hex digits'
+func parseByte(operand string) ([]byte, error) {
+	if len(operand) < 3 || operand[1] != '\'' || operand[len(operand)-1] != '\'' {
+		return nil, fmt.Errorf("Invalid constant %q", operand)
+	}
+
+	value := operand[2 : len(operand)-1]
+	switch operand[0] {
+	case 'C', 'c':
+		return []byte(value), nil
+	case 'X', 'x':
+		code, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid hex constant %q", operand)
+		}
+		return code, nil
+	}
+	return nil, fmt.Errorf("Invalid constant %q", operand)
+}
@@ -0,0 +1,204 @@
+package asm
+
+import (
+	"encoding/hex"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/uroshercog/sic-machine/obj"
+)
+
+// The SIC/XE version of the COPY program from Beck, System Software, figure 2.5
+const copySource = `COPY    START   0
+FIRST   STL     RETADR
+        LDB     #LENGTH
+        BASE    LENGTH
+CLOOP   +JSUB   RDREC
+        LDA     LENGTH
+        COMP    #0
+        JEQ     ENDFIL
+        +JSUB   WRREC
+        J       CLOOP
+ENDFIL  LDA     EOF
+        STA     BUFFER
+        LDA     #3
+        STA     LENGTH
+        +JSUB   WRREC
+        J       @RETADR
+EOF     BYTE    C'EOF'
+RETADR  RESW    1
+LENGTH  RESW    1
+BUFFER  RESB    4096
+.
+.       SUBROUTINE TO READ RECORD INTO BUFFER
+.
+RDREC   CLEAR   X
+        CLEAR   A
+        CLEAR   S
+        +LDT    #4096
+RLOOP   TD      INPUT
+        JEQ     RLOOP
+        RD      INPUT
+        COMPR   A,S
+        JEQ     EXIT
+        STCH    BUFFER,X
+        TIXR    T
+        JLT     RLOOP
+EXIT    STX     LENGTH
+        RSUB
+INPUT   BYTE    X'F1'
+.
+.       SUBROUTINE TO WRITE RECORD FROM BUFFER
+.
+WRREC   CLEAR   X
+        LDT     LENGTH
+WLOOP   TD      OUTPUT
+        JEQ     WLOOP
+        LDCH    BUFFER,X
+        WD      OUTPUT
+        TIXR    T
+        JLT     WLOOP
+        RSUB
+OUTPUT  BYTE    X'05'
+        END     FIRST
+`
+
+// The T records of the object program in figure 2.8
+const copyText = `T0000001D17202D69202D4B1010360320262900003320074B10105D3F2FEC032010
+T00001D130F20160100030F200D4B10105D3E2003454F46
+T0010361DB410B400B44075101000E32019332FFADB2013A00433200857C003B850
+T0010531D3B2FEA1340004F0000F1B410774000E32011332FFA53C003DF2008B850
+T001070073B2FEF4F000005`
+
+// Decodes T records into the bytes of the text by address
+func textImage(t *testing.T, records string) map[int32]byte {
+	cells := map[int32]byte{}
+	for _, record := range strings.Split(records, "\n") {
+		addr, err := strconv.ParseInt(record[1:7], 16, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, err := hex.DecodeString(record[9:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range code {
+			cells[int32(addr)+int32(i)] = b
+		}
+	}
+	return cells
+}
+
+// Returns the code of the program by address
+func programImage(p *Program) map[int32]byte {
+	cells := map[int32]byte{}
+	for _, line := range p.Lines {
+		for i, b := range line.Code {
+			cells[line.Address+int32(i)] = b
+		}
+	}
+	return cells
+}
+
+func TestAssembleCopy(t *testing.T) {
+	program, err := Assemble(strings.NewReader(copySource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if program.Name != "COPY" || program.Start != 0 || program.Length != 0x1077 || program.Entry != 0 {
+		t.Errorf("program %s at %06X, length %06X, entry %06X", program.Name, program.Start, program.Length, program.Entry)
+	}
+	symbols := map[string]int32{
+		"COPY":  0,
+		"FIRST": 0, "CLOOP": 6, "LENGTH": 0x33, "BUFFER": 0x36, "RDREC": 0x1036, "WRREC": 0x105D,
+	}
+	for symbol, addr := range symbols {
+		if got, ok := program.Symbols[symbol]; !ok || got != addr {
+			t.Errorf("symbol %s at %06X, want %06X", symbol, got, addr)
+		}
+	}
+
+	if got, want := programImage(program), textImage(t, copyText); !reflect.DeepEqual(got, want) {
+		t.Errorf("code differs from figure 2.8")
+	}
+	// The three +JSUB are relocated, +LDT #4096 is absolute
+	want := []*obj.Modification{
+		{Addr: 0x07, Length: 5, Sign: '+'},
+		{Addr: 0x14, Length: 5, Sign: '+'},
+		{Addr: 0x27, Length: 5, Sign: '+'},
+	}
+	if !reflect.DeepEqual(program.Modifications, want) {
+		t.Errorf("modifications %+v, want %+v", program.Modifications, want)
+	}
+}
+
+func TestAssembleRelocation(t *testing.T) {
+	src := `PROG    START   1000
+        +LDA    VALUE
+        +LDA    #4096
+        LDA     VALUE
+VALUE   WORD    PROG
+        WORD    5
+        WORD    VALUE-PROG
+        END     PROG
+`
+	program, err := Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Addresses are relative to the start, absolute operands are not relocated
+	want := []*obj.Modification{
+		{Addr: 1, Length: 5, Sign: '+'},
+		{Addr: 11, Length: 6, Sign: '+'},
+	}
+	if !reflect.DeepEqual(program.Modifications, want) {
+		t.Errorf("modifications %+v, want %+v", program.Modifications, want)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	src := `PROG    START   0
+        LDA     MISSING
+        FOO     1
+DATA    RESW    1
+DATA    RESW    1
+        +ADDR   A,X
+        END     PROG
+`
+	_, err := Assemble(strings.NewReader(src))
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("error %v, want an ErrorList", err)
+	}
+
+	// Pass 2 only runs when pass 1 found no errors
+	want := []string{
+		`line 3: Unknown operation "FOO"`,
+		`line 5: Duplicate symbol "DATA"`,
+		`line 6: ADDR cannot be extended`,
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("errors\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAssemblePass2Errors(t *testing.T) {
+	src := `PROG    START   0
+FIRST   LDA     MISSING
+        LDA     5000
+        END     FIRST
+`
+	_, err := Assemble(strings.NewReader(src))
+	want := "line 2: Undefined symbol \"MISSING\"\nline 3: Operand \"5000\" out of range, use format 4"
+	if err == nil || err.Error() != want {
+		t.Errorf("error %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,200 @@
+package asm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	oc "github.com/uroshercog/sic-machine/opcodes"
+)
+
+// Value of an expression. Relative values are addresses inside of the program.
+type value struct {
+	value    int32
+	relative bool
+}
+
+// Evaluates an expression of symbols, decimal numbers and * (the address of
+// the line) joined with + and -
+func (a *assembler) eval(expr string, loc int32) (value, error) {
+	if expr == "" {
+		return value{}, errors.New("Missing operand")
+	}
+
+	var ret value
+	relatives := 0
+
+	for expr != "" {
+		sign := int32(1)
+		if expr[0] == '+' || expr[0] == '-' {
+			if expr[0] == '-' {
+				sign = -1
+			}
+			expr = expr[1:]
+		}
+
+		end := strings.IndexAny(expr, "+-")
+		if end < 0 {
+			end = len(expr)
+		}
+		term := expr[:end]
+		expr = expr[end:]
+
+		var v int32
+		relative := false
+		if term == "*" {
+			v, relative = loc, true
+		} else if n, err := strconv.ParseInt(term, 10, 32); err == nil {
+			v = int32(n)
+		} else if addr, ok := a.program.Symbols[term]; ok {
+			v, relative = addr, true
+		} else {
+			return value{}, fmt.Errorf("Undefined symbol %q", term)
+		}
+
+		ret.value += sign * v
+		if relative {
+			relatives += int(sign)
+		}
+	}
+
+	switch relatives {
+	case 0:
+	case 1:
+		ret.relative = true
+	default:
+		return value{}, errors.New("Invalid relative expression")
+	}
+	return ret, nil
+}
+
+// Generates the code of an instruction
+func (a *assembler) encode(line *Line) ([]byte, error) {
+	st := line.st
+	op := oc.Table[st.op]
+
+	switch op.Format {
+	case 1:
+		return []byte{op.Code}, nil
+	case 2:
+		r1, r2, err := a.encodeRegisters(op, st.operand)
+		return []byte{op.Code, r1<<4 | r2}, err
+	}
+
+	if op.Operands == oc.OperandsNone {
+		// Simple addressing with no operand
+		if st.extended {
+			return []byte{op.Code | 0x3, 0x10, 0x00, 0x00}, nil
+		}
+		return []byte{op.Code | 0x3, 0x00, 0x00}, nil
+	}
+
+	operand := st.operand
+	var n, i, x, b, p, e byte
+
+	switch {
+	case strings.HasPrefix(operand, "#"):
+		i = 1
+		operand = operand[1:]
+	case strings.HasPrefix(operand, "@"):
+		n = 1
+		operand = operand[1:]
+	default:
+		n, i = 1, 1
+	}
+
+	if strings.HasSuffix(strings.ToUpper(operand), ",X") {
+		if n != i {
+			return nil, errors.New("Indexed addressing cannot be immediate or indirect")
+		}
+		x = 1
+		operand = operand[:len(operand)-2]
+	}
+
+	target, err := a.eval(operand, line.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if st.extended {
+		e = 1
+		if target.value < 0 || target.value > 0xFFFFF {
+			return nil, fmt.Errorf("Address %#x out of range", target.value)
+		}
+		// The 20-bit address depends on where the program is loaded
+		if target.relative {
+			a.relocate(line.Address+1, 5)
+		}
+		return []byte{
+			op.Code | n<<1 | i,
+			(x<<3|b<<2|p<<1|e)<<4 | byte(target.value>>16)&0xF,
+			byte(target.value >> 8),
+			byte(target.value),
+		}, nil
+	}
+
+	var disp int32
+	if !target.relative {
+		// Absolute values are used directly
+		if target.value < 0 || target.value > 0xFFF {
+			return nil, fmt.Errorf("Operand %q out of range, use format 4", operand)
+		}
+		disp = target.value
+	} else if d := target.value - (line.Address + 3); d >= -2048 && d <= 2047 {
+		p = 1
+		disp = d & 0xFFF
+	} else if d := target.value - a.base; a.hasBase && d >= 0 && d <= 0xFFF {
+		b = 1
+		disp = d
+	} else {
+		return nil, fmt.Errorf("Operand %q out of range, use format 4", operand)
+	}
+
+	return []byte{
+		op.Code | n<<1 | i,
+		(x<<3|b<<2|p<<1|e)<<4 | byte(disp>>8)&0xF,
+		byte(disp),
+	}, nil
+}
+
+// Encodes the operands of a format 2 instruction
+func (a *assembler) encodeRegisters(op *oc.Opcode, operand string) (r1, r2 byte, err error) {
+	args := strings.Split(operand, ",")
+	if len(args) != len(strings.Split(op.Operands, ",")) {
+		return 0, 0, fmt.Errorf("%s expects operands %s", op.Mnemonic, op.Operands)
+	}
+
+	register := func(name string) (byte, error) {
+		r, ok := oc.Registers[strings.ToUpper(name)]
+		if !ok {
+			return 0, fmt.Errorf("Unknown register %q", name)
+		}
+		return r, nil
+	}
+
+	number := func(str string, min, max int64) (byte, error) {
+		n, err := strconv.ParseInt(str, 10, 8)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("Invalid number %q", str)
+		}
+		return byte(n), nil
+	}
+
+	switch op.Operands {
+	case oc.OperandsR1R2:
+		if r1, err = register(args[0]); err == nil {
+			r2, err = register(args[1])
+		}
+	case oc.OperandsR1:
+		r1, err = register(args[0])
+	case oc.OperandsN:
+		r1, err = number(args[0], 0, 15)
+	case oc.OperandsR1N:
+		if r1, err = register(args[0]); err == nil {
+			r2, err = number(args[1], 1, 16)
+			r2--
+		}
+	}
+	return
+}
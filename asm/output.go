@@ -0,0 +1,62 @@
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/obj"
+)
+
+// WriteObject writes the program as H, T, M and E records
+func (p *Program) WriteObject(w io.Writer) error {
+	objCode := obj.New(p.Name, p.Start, p.Length)
+	for _, line := range p.Lines {
+		objCode.AddText(line.Address, line.Code)
+	}
+	objCode.Modifications = p.Modifications
+	objCode.SetStart(p.Entry)
+	return objCode.Write(w)
+}
+
+// WriteListing writes the source annotated with addresses and code, followed by the symbol table
+func (p *Program) WriteListing(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%-5s %-6s  %-8s  %s\n", "Line", "Loc", "Code", "Source")
+
+	for _, line := range p.Lines {
+		loc := ""
+		if line.Address >= 0 {
+			loc = fmt.Sprintf("%06X", line.Address)
+		}
+
+		// Long constants continue on the following lines
+		code := fmt.Sprintf("%X", line.Code)
+		first := code
+		if len(first) > 8 {
+			first = first[:8]
+		}
+		fmt.Fprintf(bw, "%5d %-6s  %-8s  %s\n", line.Number, loc, first, strings.TrimRight(line.Source, "\r"))
+		for i := 8; i < len(code); i += 8 {
+			end := i + 8
+			if end > len(code) {
+				end = len(code)
+			}
+			fmt.Fprintf(bw, "%5s %-6s  %s\n", "", "", code[i:end])
+		}
+	}
+
+	names := make([]string, 0, len(p.Symbols))
+	for name := range p.Symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(bw, "\nSymbols\n")
+	for _, name := range names {
+		fmt.Fprintf(bw, "%-8s %06X\n", name, p.Symbols[name])
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,86 @@
+package asm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A line of the source, split into its fields
+type statement struct {
+	label    string
+	op       string
+	extended bool
+	operand  string
+}
+
+// Splits a source line into label, operation and operand. Lines that are
+// empty or start with '.' are comments and return nil.
+func parseLine(src string) *statement {
+	src = strings.TrimRight(src, "\r\n")
+	if trimmed := strings.TrimSpace(src); trimmed == "" || trimmed[0] == '.' {
+		return nil
+	}
+
+	tokens := fields(src)
+	st := &statement{}
+
+	// A label must start in the first column
+	if !unicode.IsSpace(rune(src[0])) {
+		st.label = tokens[0]
+		tokens = tokens[1:]
+	}
+
+	if len(tokens) > 0 {
+		st.op = strings.ToUpper(tokens[0])
+		if strings.HasPrefix(st.op, "+") {
+			st.extended = true
+			st.op = st.op[1:]
+		}
+	}
+
+	if len(tokens) > 1 {
+		st.operand = tokens[1]
+	}
+	return st
+}
+
+// Splits the line on whitespace, keeping quoted constants such as C'A B' in one field
+func fields(src string) []string {
+	var tokens []string
+	var token []rune
+	quoted := false
+
+	for _, c := range src {
+		if c == '\'' {
+			quoted = !quoted
+		}
+
+		if unicode.IsSpace(c) && !quoted {
+			if len(token) > 0 {
+				tokens = append(tokens, string(token))
+				token = token[:0]
+			}
+			continue
+		}
+		token = append(token, c)
+	}
+
+	if len(token) > 0 {
+		tokens = append(tokens, string(token))
+	}
+	return tokens
+}
+
+// Reports whether name can be used as a symbol
+func isSymbol(name string) bool {
+	if name == "" || !unicode.IsLetter(rune(name[0])) {
+		return false
+	}
+
+	for _, c := range name {
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/asm"
+)
+
+var (
+	objectFile  = flag.String("o", "", "object file, the source name with .obj by default")
+	listingFile = flag.String("l", "", "listing file, the source name with .lst by default")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <source file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	source := flag.Arg(0)
+	base := strings.TrimSuffix(source, filepath.Ext(source))
+
+	f, err := os.Open(source)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	program, err := asm.Assemble(f)
+	if errs, ok := err.(asm.ErrorList); ok {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", source, e.Line, e.Msg)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if *objectFile == "" {
+		*objectFile = base + ".obj"
+	}
+	if *listingFile == "" {
+		*listingFile = base + ".lst"
+	}
+
+	if err := write(*objectFile, program.WriteObject); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := write(*listingFile, program.WriteListing); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func write(filename string, f func(w io.Writer) error) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := f(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
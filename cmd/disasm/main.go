@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/uroshercog/sic-machine/disasm"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+)
+
+func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "Exception: %v\n", r)
+			os.Exit(1)
+		}
+	}()
+
+	if len(os.Args) < 2 {
+		fmt.Fprintf(os.Stderr, "Usage: %s <object file>...\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	for _, filename := range os.Args[1:] {
+		for _, objCode := range parseObjectCode(filename) {
+			disassemble(out, filename, objCode)
+		}
+	}
+}
+
+// Every section is loaded on its own, sections of a file may overlap before they are linked
+func disassemble(out *bufio.Writer, filename string, objCode *obj.ObjectCode) {
+	// The section is not relocated, so external symbols do not need to be resolved
+	RAM := memory.New()
+	cells := RAM.GetRaw()
+	for _, body := range objCode.Code {
+		copy(cells[body.StartAddr:], body.Code)
+	}
+
+	// T records split instructions, so contiguous text is disassembled as one
+	// stream, continuing after the last instruction of the previous record
+	bodies := append([]*obj.BodyObjectCode(nil), objCode.Code...)
+	sort.SliceStable(bodies, func(i, j int) bool {
+		return bodies[i].StartAddr < bodies[j].StartAddr
+	})
+
+	fmt.Fprintf(out, "%s: %s\n", filename, objCode.Name)
+	addr := int32(0)
+	for _, body := range bodies {
+		// Bytes that are not instructions are shown as BYTE
+		if addr < body.StartAddr {
+			addr = body.StartAddr
+		}
+		for addr < body.StartAddr+body.Length {
+			inst, err := disasm.Decode(RAM, addr)
+			if inst == nil {
+				panic(err)
+			}
+			fmt.Fprintf(out, "%06X  %-8X  %s\n", addr, inst.Bytes, inst)
+			addr += inst.Length
+		}
+	}
+	if objCode.HasStart {
+		fmt.Fprintf(out, "Start %06X\n", objCode.StartAddr)
+	}
+}
+
+func parseObjectCode(filename string) []*obj.ObjectCode {
+	f, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	sections, err := obj.Parse(f, filename)
+	if err != nil {
+		panic(err)
+	}
+	return sections
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uroshercog/sic-machine/trace"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:\n")
+	fmt.Fprintf(os.Stderr, "  %s export <trace>    print the trace as text\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "  %s diff <a> <b>      report where two traces first diverge\n", os.Args[0])
+	os.Exit(2)
+}
+
+func main() {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "Exception: %v\n", r)
+			os.Exit(1)
+		}
+	}()
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "export":
+		if len(os.Args) != 3 {
+			usage()
+		}
+		if err := trace.Export(os.Stdout, open(os.Args[2])); err != nil {
+			panic(err)
+		}
+	case "diff":
+		if len(os.Args) != 4 {
+			usage()
+		}
+		d, err := trace.Diff(open(os.Args[2]), open(os.Args[3]))
+		if err != nil {
+			panic(err)
+		}
+		if d == nil {
+			fmt.Println("Traces are the same")
+			return
+		}
+
+		fmt.Printf("Traces diverge at step %d: %s\n", d.Step, d.Reason)
+		if d.A != nil {
+			fmt.Printf("< %s\n", trace.Format(d.A))
+		}
+		if d.B != nil {
+			fmt.Printf("> %s\n", trace.Format(d.B))
+		}
+		os.Exit(1)
+	default:
+		usage()
+	}
+}
+
+// The files stay open until the command exits
+func open(filename string) *trace.Reader {
+	f, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	tr, err := trace.NewReader(f)
+	if err != nil {
+		panic(fmt.Errorf("%s: %v", filename, err))
+	}
+	return tr
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/uroshercog/sic-machine/loader"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+)
+
+var noLink = flag.Bool("no-link", false, "only check every file on its own, without linking them together")
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <object file>...\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Checks the object files and links them like the machine would, without running them\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	valid := true
+	var sections []*obj.ObjectCode
+	for _, filename := range flag.Args() {
+		s, err := parse(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			valid = false
+			continue
+		}
+		sections = append(sections, s...)
+	}
+
+	// Symbols can only be resolved when all the sections are valid
+	if valid && !*noLink {
+		if _, err := loader.Load(memory.New(), sections, sections[0].LoadAddr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			valid = false
+		}
+	}
+
+	if !valid {
+		os.Exit(1)
+	}
+	fmt.Printf("OK, %d control sections\n", len(sections))
+}
+
+func parse(filename string) ([]*obj.ObjectCode, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return obj.Parse(f, filename)
+}
@@ -0,0 +1,266 @@
+package dap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+type sourceBreakpoint struct {
+	Line         int    `json:"line"`
+	Condition    string `json:"condition"`
+	HitCondition string `json:"hitCondition"`
+}
+
+type setBreakpointsArguments struct {
+	Source struct {
+		Path string `json:"path"`
+	} `json:"source"`
+	Breakpoints []sourceBreakpoint `json:"breakpoints"`
+}
+
+type functionBreakpoint struct {
+	// Symbol from the listing or an address
+	Name         string `json:"name"`
+	Condition    string `json:"condition"`
+	HitCondition string `json:"hitCondition"`
+}
+
+type instructionBreakpoint struct {
+	InstructionReference string `json:"instructionReference"`
+	Offset               int32  `json:"offset"`
+	Condition            string `json:"condition"`
+	HitCondition         string `json:"hitCondition"`
+}
+
+// Replaces the breakpoints of a source file, lines are mapped to addresses with the listing
+func (s *Server) setBreakpoints(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &setBreakpointsArguments{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	path := args.Source.Path
+	s.removeBreakpoints(s.sourceBreakpoints[path])
+	delete(s.sourceBreakpoints, path)
+
+	var ids []int
+	result := []map[string]interface{}{}
+	for _, b := range args.Breakpoints {
+		if s.listing == nil || !sameFile(path, s.source) {
+			result = append(result, unverified(b.Line, "No listing for "+filepath.Base(path)))
+			continue
+		}
+
+		addr, line, ok := s.listing.Address(b.Line)
+		if !ok {
+			result = append(result, unverified(b.Line, "No code at or after the line"))
+			continue
+		}
+
+		id, err := s.addBreakpoint(addr, b.Condition, b.HitCondition)
+		if err != nil {
+			result = append(result, unverified(b.Line, err.Error()))
+			continue
+		}
+
+		ids = append(ids, id)
+		result = append(result, map[string]interface{}{
+			"id":                   id,
+			"verified":             true,
+			"line":                 line,
+			"instructionReference": fmt.Sprintf("0x%06X", addr),
+		})
+	}
+
+	s.sourceBreakpoints[path] = ids
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// Replaces the breakpoints on symbols and addresses
+func (s *Server) setFunctionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &struct {
+		Breakpoints []functionBreakpoint `json:"breakpoints"`
+	}{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	s.removeBreakpoints(s.functionBreakpoints)
+	s.functionBreakpoints = nil
+
+	result := []map[string]interface{}{}
+	for _, b := range args.Breakpoints {
+		addr, err := s.address(b.Name)
+		if err == nil {
+			var id int
+			if id, err = s.addBreakpoint(addr, b.Condition, b.HitCondition); err == nil {
+				s.functionBreakpoints = append(s.functionBreakpoints, id)
+				result = append(result, s.verified(id, addr))
+				continue
+			}
+		}
+		result = append(result, unverified(0, err.Error()))
+	}
+
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// Replaces the breakpoints set from the disassembly
+func (s *Server) setInstructionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &struct {
+		Breakpoints []instructionBreakpoint `json:"breakpoints"`
+	}{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	s.removeBreakpoints(s.instructionBreakpoints)
+	s.instructionBreakpoints = nil
+
+	result := []map[string]interface{}{}
+	for _, b := range args.Breakpoints {
+		addr, err := parseAddress(b.InstructionReference)
+		if err == nil {
+			var id int
+			if id, err = s.addBreakpoint(addr+b.Offset, b.Condition, b.HitCondition); err == nil {
+				s.instructionBreakpoints = append(s.instructionBreakpoints, id)
+				result = append(result, s.verified(id, addr+b.Offset))
+				continue
+			}
+		}
+		result = append(result, unverified(0, err.Error()))
+	}
+
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// Faults always stop the CPU, there are no exception filters
+func (s *Server) setExceptionBreakpoints(raw json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{"breakpoints": []interface{}{}}, nil
+}
+
+func (s *Server) addBreakpoint(addr int32, condition, hitCondition string) (int, error) {
+	bp := &processor.Breakpoint{Kind: processor.BreakExecute, Address: addr}
+
+	if condition != "" {
+		c, err := parseCondition(condition)
+		if err != nil {
+			return 0, err
+		}
+		bp.Condition = c
+	}
+
+	if hitCondition != "" {
+		// The breakpoint stops the CPU on the nth hit
+		n, err := strconv.Atoi(strings.TrimSpace(hitCondition))
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("Invalid hit count %q", hitCondition)
+		}
+		bp.IgnoreCount = n - 1
+	}
+
+	return s.cpu.Breakpoints.Add(bp), nil
+}
+
+func (s *Server) removeBreakpoints(ids []int) {
+	for _, id := range ids {
+		s.cpu.Breakpoints.Remove(id)
+	}
+}
+
+func (s *Server) verified(id int, addr int32) map[string]interface{} {
+	bp := map[string]interface{}{
+		"id":                   id,
+		"verified":             true,
+		"instructionReference": fmt.Sprintf("0x%06X", addr),
+	}
+	if s.listing != nil {
+		if line := s.listing.Line(addr); line != nil {
+			bp["line"] = line.Number
+		}
+	}
+	return bp
+}
+
+func unverified(line int, message string) map[string]interface{} {
+	bp := map[string]interface{}{
+		"verified": false,
+		"message":  message,
+	}
+	if line > 0 {
+		bp["line"] = line
+	}
+	return bp
+}
+
+// Resolves a symbol from the listing or an address
+func (s *Server) address(name string) (int32, error) {
+	if s.listing != nil {
+		if addr, ok := s.listing.Symbols[name]; ok {
+			return addr, nil
+		}
+	}
+	return parseAddress(name)
+}
+
+func parseAddress(str string) (int32, error) {
+	addr, err := strconv.ParseInt(strings.TrimSpace(str), 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid address %q", str)
+	}
+	return int32(addr), nil
+}
+
+// Parses a condition of the form register op value, such as A >= 10
+func parseCondition(str string) (*processor.Condition, error) {
+	fields := strings.Fields(str)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("Invalid condition %q, expected register op value", str)
+	}
+
+	r, ok := registerIndex(fields[0])
+	if !ok || r == processor.RegF {
+		return nil, fmt.Errorf("Invalid register %q", fields[0])
+	}
+
+	switch fields[1] {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("Invalid operator %q", fields[1])
+	}
+
+	value, err := strconv.ParseInt(fields[2], 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid value %q", fields[2])
+	}
+
+	return &processor.Condition{Register: r, Op: fields[1], Value: int32(value)}, nil
+}
+
+// Reports whether a and b name the same file
+func sameFile(a, b string) bool {
+	fa, errA := os.Stat(a)
+	fb, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(fa, fb)
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,77 @@
+package dap
+
+import (
+	"errors"
+	"sync"
+)
+
+// The streams of the adapter carry the protocol, so the standard devices of
+// the guest are replaced by the debug console
+
+// outputDevice sends what the guest writes to the client as output events
+type outputDevice struct {
+	mx       sync.Mutex
+	conn     *conn
+	category string
+	buffer   []byte
+}
+
+func (od *outputDevice) Read() (byte, error) {
+	return 0, errors.New("Output device cannot be read")
+}
+
+// Write buffers the output until the end of the line
+func (od *outputDevice) Write(value byte) error {
+	od.mx.Lock()
+	defer od.mx.Unlock()
+
+	od.buffer = append(od.buffer, value)
+	if value == '\n' {
+		return od.flush()
+	}
+	return nil
+}
+
+func (od *outputDevice) Test() bool {
+	return true
+}
+
+// Flush sends the output that is not terminated by a newline yet
+func (od *outputDevice) Flush() error {
+	od.mx.Lock()
+	defer od.mx.Unlock()
+	return od.flush()
+}
+
+func (od *outputDevice) flush() error {
+	if len(od.buffer) == 0 {
+		return nil
+	}
+	err := od.conn.event("output", map[string]interface{}{
+		"category": od.category,
+		"output":   string(od.buffer),
+	})
+	od.buffer = nil
+	return err
+}
+
+// inputDevice has no input, the streams of the adapter belong to the client
+type inputDevice struct{}
+
+func (inputDevice) Read() (byte, error) {
+	return 0, errors.New("No input while debugging")
+}
+
+func (inputDevice) Write(value byte) error {
+	return errors.New("Input device cannot be written")
+}
+
+// Test reports the device as never ready, there is nothing to read
+func (inputDevice) Test() bool {
+	return false
+}
+
+// Ended reports the input as ended, so that TD sets CC to >
+func (inputDevice) Ended() bool {
+	return true
+}
@@ -0,0 +1,164 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Columns of a listing written by asm.Program.WriteListing
+const (
+	colNumber = 0
+	colLoc    = 6
+	colCode   = 14
+	colSource = 24
+)
+
+// ListingLine is a source line with its address and code
+type ListingLine struct {
+	Number  int
+	Address int32 // -1 if the line has no address
+	Code    []byte
+	Source  string
+}
+
+// Listing maps source lines to addresses
+type Listing struct {
+	Lines   []*ListingLine
+	Symbols map[string]int32
+}
+
+// ParseListing parses a listing written by the assembler
+func ParseListing(r io.Reader) (*Listing, error) {
+	l := &Listing{Symbols: map[string]int32{}}
+	scanner := bufio.NewScanner(r)
+
+	symbols := false
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+
+		switch {
+		case n == 1 && strings.HasPrefix(text, "Line"):
+			continue
+		case strings.TrimSpace(text) == "":
+			continue
+		case text == "Symbols":
+			symbols = true
+			continue
+		}
+
+		if symbols {
+			fields := strings.Fields(text)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("Line %d: invalid symbol", n)
+			}
+			addr, err := strconv.ParseUint(fields[1], 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %v", n, err)
+			}
+			l.Symbols[fields[0]] = int32(addr)
+			continue
+		}
+
+		line, err := parseListingLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", n, err)
+		}
+
+		if line.Number == 0 {
+			// Code of a long constant continues on the following lines
+			if len(l.Lines) == 0 {
+				return nil, fmt.Errorf("Line %d: continuation without a line", n)
+			}
+			prev := l.Lines[len(l.Lines)-1]
+			prev.Code = append(prev.Code, line.Code...)
+			continue
+		}
+		l.Lines = append(l.Lines, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Returns the text in the columns [from, to) of the line
+func column(text string, from, to int) string {
+	if from >= len(text) {
+		return ""
+	}
+	if to < 0 || to > len(text) {
+		to = len(text)
+	}
+	return text[from:to]
+}
+
+func parseListingLine(text string) (*ListingLine, error) {
+	line := &ListingLine{Address: -1}
+
+	if number := strings.TrimSpace(column(text, colNumber, colLoc)); number != "" {
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, err
+		}
+		line.Number = n
+	}
+
+	if loc := strings.TrimSpace(column(text, colLoc, colCode)); loc != "" {
+		addr, err := strconv.ParseUint(loc, 16, 32)
+		if err != nil {
+			return nil, err
+		}
+		line.Address = int32(addr)
+	}
+
+	code := strings.TrimSpace(column(text, colCode, colSource))
+	if line.Number == 0 {
+		// Continuation lines hold only code
+		code = strings.TrimSpace(text)
+	}
+	var err error
+	if line.Code, err = hex.DecodeString(code); err != nil {
+		return nil, err
+	}
+
+	line.Source = column(text, colSource, -1)
+	return line, nil
+}
+
+// Address returns the address of the first line at or after number that
+// generates code, and the number of that line
+func (l *Listing) Address(number int) (int32, int, bool) {
+	for _, line := range l.Lines {
+		if line.Number >= number && line.Address >= 0 && len(line.Code) > 0 {
+			return line.Address, line.Number, true
+		}
+	}
+	return 0, 0, false
+}
+
+// Line returns the line whose code contains addr, or nil
+func (l *Listing) Line(addr int32) *ListingLine {
+	for _, line := range l.Lines {
+		if line.Address >= 0 && addr >= line.Address && addr < line.Address+int32(len(line.Code)) {
+			return line
+		}
+	}
+	return nil
+}
+
+// Symbol returns the name of the symbol at addr, the first in order if there
+// are several
+func (l *Listing) Symbol(addr int32) (string, bool) {
+	found := ""
+	for name, a := range l.Symbols {
+		if a == addr && (found == "" || name < found) {
+			found = name
+		}
+	}
+	return found, found != ""
+}
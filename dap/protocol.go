@@ -0,0 +1,116 @@
+// Package dap serves the Debug Adapter Protocol over a pair of streams, so
+// SIC/XE programs can be debugged from editors.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// Request from the client
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+// Reads and writes messages framed with a Content-Length header
+type conn struct {
+	r *textproto.Reader
+
+	// Events are sent from CPU hooks while requests are handled
+	mx  sync.Mutex
+	w   io.Writer
+	seq int
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{
+		r: textproto.NewReader(bufio.NewReader(r)),
+		w: w,
+	}
+}
+
+func (c *conn) read() (*request, error) {
+	header, err := c.r.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid Content-Length %q", header.Get("Content-Length"))
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r.R, data); err != nil {
+		return nil, err
+	}
+
+	req := &request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (c *conn) respond(req *request, body interface{}, err error) error {
+	res := &response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    err == nil,
+		Command:    req.Command,
+		Body:       body,
+	}
+	if err != nil {
+		res.Message = err.Error()
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.seq++
+	res.Seq = c.seq
+	return c.write(res)
+}
+
+func (c *conn) event(name string, body interface{}) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.seq++
+	return c.write(&event{Seq: c.seq, Type: "event", Event: name, Body: body})
+}
+
+func (c *conn) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(data)
+	return err
+}
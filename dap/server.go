@@ -0,0 +1,586 @@
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/disasm"
+	"github.com/uroshercog/sic-machine/loader"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// The CPU is the only thread
+const threadID = 1
+
+var errNotLaunched = errors.New("No program launched")
+
+// Subroutine call made with JSUB
+type frame struct {
+	call   int32 // address of the JSUB
+	target int32
+}
+
+// Step over or out of a subroutine, it ends when the breakpoint is hit with
+// at most depth calls on the stack
+type step struct {
+	breakpoint int
+	depth      int
+}
+
+type handler func(s *Server, args json.RawMessage) (interface{}, error)
+
+var handlers = map[string]handler{
+	"initialize":                (*Server).initialize,
+	"launch":                    (*Server).launch,
+	"configurationDone":         (*Server).configurationDone,
+	"setBreakpoints":            (*Server).setBreakpoints,
+	"setFunctionBreakpoints":    (*Server).setFunctionBreakpoints,
+	"setInstructionBreakpoints": (*Server).setInstructionBreakpoints,
+	"setExceptionBreakpoints":   (*Server).setExceptionBreakpoints,
+	"threads":                   (*Server).threads,
+	"stackTrace":                (*Server).stackTrace,
+	"scopes":                    (*Server).scopes,
+	"variables":                 (*Server).variables,
+	"setVariable":               (*Server).setVariable,
+	"readMemory":                (*Server).readMemory,
+	"writeMemory":               (*Server).writeMemory,
+	"continue":                  (*Server).cont,
+	"next":                      (*Server).next,
+	"stepIn":                    (*Server).stepIn,
+	"stepOut":                   (*Server).stepOut,
+	"stepBack":                  (*Server).stepBack,
+	"reverseContinue":           (*Server).reverseContinue,
+	"pause":                     (*Server).pause,
+	"disconnect":                (*Server).disconnect,
+	"terminate":                 (*Server).disconnect,
+}
+
+// Server is a debug adapter for a single program
+type Server struct {
+	conn *conn
+
+	cpu     *processor.CPU
+	ram     *memory.RAM
+	stdout  *outputDevice
+	stderr  *outputDevice
+	program string // name from the H record
+	source  string
+	listing *Listing
+
+	stopOnEntry bool
+
+	// Protects the state the CPU hooks use while it runs
+	mx       sync.Mutex
+	stack    []frame
+	stepping *step
+	// Frames popped by RSUB, they are pushed back when the RSUB is undone.
+	// At most twice as many are kept as instructions fit in the journal.
+	returned []frame
+	journal  int
+	// Set when the client disconnects, the CPU stops without an event
+	done bool
+
+	// IDs of the CPU breakpoints set by each kind of request, source breakpoints by path
+	sourceBreakpoints      map[string][]int
+	functionBreakpoints    []int
+	instructionBreakpoints []int
+
+	// Called after the response to the current request is sent
+	after func()
+}
+
+// NewServer creates an adapter that reads requests from r and writes to w
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{
+		conn:              newConn(r, w),
+		sourceBreakpoints: map[string][]int{},
+	}
+}
+
+// Serve handles requests until the client disconnects
+func (s *Server) Serve() error {
+	for {
+		s.mx.Lock()
+		done := s.done
+		s.mx.Unlock()
+		if done {
+			break
+		}
+
+		req, err := s.conn.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		body, err := s.handle(req)
+		if err := s.conn.respond(req, body, err); err != nil {
+			return err
+		}
+
+		if s.after != nil {
+			s.after()
+			s.after = nil
+		}
+	}
+
+	if s.cpu != nil {
+		s.cpu.Stop()
+	}
+	return nil
+}
+
+// Handles a request, panics of the machine are reported as errors
+func (s *Server) handle(req *request) (body interface{}, err error) {
+	h, ok := handlers[req.Command]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported request %q", req.Command)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			body, err = nil, fmt.Errorf("%v", r)
+		}
+	}()
+	return h(s, req.Arguments)
+}
+
+func (s *Server) initialize(args json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"supportsConfigurationDoneRequest":  true,
+		"supportsFunctionBreakpoints":       true,
+		"supportsConditionalBreakpoints":    true,
+		"supportsHitConditionalBreakpoints": true,
+		"supportsInstructionBreakpoints":    true,
+		"supportsSetVariable":               true,
+		"supportsReadMemoryRequest":         true,
+		"supportsWriteMemoryRequest":        true,
+		"supportsTerminateRequest":          true,
+		"supportsStepBack":                  true,
+	}, nil
+}
+
+type launchArguments struct {
+	// Object file to run
+	Program string `json:"program"`
+	// Listing written by the assembler, defaults to the program with the .lst extension
+	Listing string `json:"listing"`
+	// Source of the program, defaults to the program with the .asm extension
+	Source      string `json:"source"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+	// Instructions per second, 0 runs as fast as possible
+	Speed int64 `json:"speed"`
+	// Number of instructions that can be stepped back
+	Journal int `json:"journal"`
+}
+
+func (s *Server) launch(raw json.RawMessage) (interface{}, error) {
+	args := &launchArguments{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+	if args.Program == "" {
+		return nil, errors.New("No program given")
+	}
+
+	sections, err := loadObjectCode(args.Program)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(args.Program, filepath.Ext(args.Program))
+	if args.Listing == "" {
+		args.Listing = base + ".lst"
+	}
+	if args.Source == "" {
+		args.Source = base + ".asm"
+	}
+
+	// Debugging works without a listing, only by address
+	if f, err := os.Open(args.Listing); err == nil {
+		s.listing, err = ParseListing(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", args.Listing, err)
+		}
+	}
+
+	s.stdout = &outputDevice{conn: s.conn, category: "stdout"}
+	s.stderr = &outputDevice{conn: s.conn, category: "stderr"}
+	devices := dev.New()
+	devices.Set(0, inputDevice{})
+	devices.Set(1, s.stdout)
+	devices.Set(2, s.stderr)
+
+	s.ram = memory.New()
+	s.cpu = processor.NewCPU(s.ram, devices)
+	if err := s.cpu.SetSpeed(args.Speed); err != nil {
+		return nil, err
+	}
+
+	s.cpu.SetJournalSize(args.Journal)
+	s.journal = args.Journal
+
+	start, err := loader.Load(s.ram, sections, sections[0].LoadAddr)
+	if err != nil {
+		return nil, err
+	}
+	s.cpu.SetStart(start)
+
+	s.program = strings.TrimSpace(sections[0].Name)
+	s.source = args.Source
+	s.stopOnEntry = args.StopOnEntry
+
+	s.cpu.OnExec = append(s.cpu.OnExec, s.executed)
+	s.cpu.OnStop = append(s.cpu.OnStop, s.stopped)
+	s.cpu.OnStepBack = append(s.cpu.OnStepBack, s.undone)
+
+	s.after = func() {
+		s.conn.event("initialized", nil)
+	}
+	return nil, nil
+}
+
+// Parses the control sections of an object file
+func loadObjectCode(filename string) ([]*obj.ObjectCode, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return obj.Read(f, filename, obj.FormatAuto)
+}
+
+func (s *Server) configurationDone(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	if s.stopOnEntry {
+		s.after = func() {
+			s.sendStopped("entry", "", nil)
+		}
+	} else {
+		s.after = s.cpu.Start
+	}
+	return nil, nil
+}
+
+// Keeps track of the subroutine calls, called with the CPU locked
+func (s *Server) executed(inst *disasm.Instruction) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	switch inst.Mnemonic {
+	case "JSUB":
+		s.stack = append(s.stack, frame{call: inst.Address, target: s.cpu.GetRegister(processor.RegPC)})
+	case "RSUB":
+		if len(s.stack) > 0 {
+			if s.journal > 0 {
+				s.returned = append(s.returned, s.stack[len(s.stack)-1])
+				// Older frames are dropped in batches, RSUBs past the journal cannot be undone
+				if len(s.returned) > 2*s.journal {
+					s.returned = append(s.returned[:0], s.returned[len(s.returned)-s.journal:]...)
+				}
+			}
+			s.stack = s.stack[:len(s.stack)-1]
+		}
+	}
+}
+
+// Reverts the call stack when an instruction is undone
+func (s *Server) undone(inst *disasm.Instruction) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	switch inst.Mnemonic {
+	case "JSUB":
+		if len(s.stack) > 0 {
+			s.stack = s.stack[:len(s.stack)-1]
+		}
+	case "RSUB":
+		if len(s.returned) > 0 {
+			s.stack = append(s.stack, s.returned[len(s.returned)-1])
+			s.returned = s.returned[:len(s.returned)-1]
+		}
+	}
+}
+
+// Reports why the CPU stopped, called with the CPU locked
+func (s *Server) stopped(reason *processor.StopReason) {
+	s.mx.Lock()
+	if s.done {
+		s.mx.Unlock()
+		return
+	}
+	stepping := s.stepping
+	if stepping != nil && reason.Kind == processor.StopBreakpoint && reason.Breakpoint.ID == stepping.breakpoint {
+		if len(s.stack) > stepping.depth {
+			// A recursive call returned to the same address, keep going
+			s.mx.Unlock()
+			go s.cpu.Start()
+			return
+		}
+	}
+	if stepping != nil {
+		s.cpu.Breakpoints.Remove(stepping.breakpoint)
+		s.stepping = nil
+	}
+	s.mx.Unlock()
+
+	s.stdout.Flush()
+	s.stderr.Flush()
+
+	switch {
+	case stepping != nil && reason.Kind == processor.StopBreakpoint && reason.Breakpoint.ID == stepping.breakpoint:
+		s.sendStopped("step", "", nil)
+	case reason.Kind == processor.StopBreakpoint:
+		name := "breakpoint"
+		if reason.Breakpoint.Kind != processor.BreakExecute {
+			name = "data breakpoint"
+		}
+		s.sendStopped(name, "", []int{reason.Breakpoint.ID})
+	case reason.Kind == processor.StopFault:
+		s.sendStopped("exception", reason.Fault.Error(), nil)
+	default:
+		s.sendStopped("pause", "", nil)
+	}
+}
+
+func (s *Server) sendStopped(reason, text string, breakpoints []int) {
+	body := map[string]interface{}{
+		"reason":            reason,
+		"threadId":          threadID,
+		"allThreadsStopped": true,
+	}
+	if text != "" {
+		body["description"] = text
+		body["text"] = text
+	}
+	if breakpoints != nil {
+		body["hitBreakpointIds"] = breakpoints
+	}
+	s.conn.event("stopped", body)
+}
+
+func (s *Server) threads(args json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"threads": []map[string]interface{}{{"id": threadID, "name": "CPU"}},
+	}, nil
+}
+
+func (s *Server) stackTrace(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	s.mx.Lock()
+	stack := append([]frame(nil), s.stack...)
+	s.mx.Unlock()
+
+	// The innermost frame is at PC, the callers at their JSUB
+	frames := []map[string]interface{}{}
+	pc := s.cpu.GetRegister(processor.RegPC)
+	for i := len(stack); i >= 0; i-- {
+		name := s.program
+		if i > 0 {
+			name = s.name(stack[i-1].target)
+		}
+		frames = append(frames, s.frame(len(stack)-i, name, pc))
+		if i > 0 {
+			pc = stack[i-1].call
+		}
+	}
+
+	return map[string]interface{}{
+		"stackFrames": frames,
+		"totalFrames": len(frames),
+	}, nil
+}
+
+func (s *Server) frame(id int, name string, addr int32) map[string]interface{} {
+	f := map[string]interface{}{
+		"id":                          id,
+		"name":                        name,
+		"line":                        0,
+		"column":                      0,
+		"instructionPointerReference": fmt.Sprintf("0x%06X", addr),
+	}
+
+	if s.listing != nil {
+		if line := s.listing.Line(addr); line != nil {
+			f["line"] = line.Number
+			f["column"] = 1
+			f["source"] = map[string]interface{}{
+				"name": filepath.Base(s.source),
+				"path": s.source,
+			}
+		}
+	}
+	return f
+}
+
+// Returns the symbol at addr or the address
+func (s *Server) name(addr int32) string {
+	if s.listing != nil {
+		if name, ok := s.listing.Symbol(addr); ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%06X", addr)
+}
+
+func (s *Server) pause(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+	s.cpu.Stop()
+	return nil, nil
+}
+
+func (s *Server) cont(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+	s.after = s.cpu.Start
+	return map[string]interface{}{"allThreadsContinued": true}, nil
+}
+
+// Executes a single instruction
+func (s *Server) stepIn(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	s.after = func() {
+		err := s.cpu.Exec()
+		s.stdout.Flush()
+		s.stderr.Flush()
+
+		if err != nil {
+			s.sendStopped("exception", err.Error(), nil)
+		} else {
+			s.sendStopped("step", "", nil)
+		}
+	}
+	return nil, nil
+}
+
+// Steps over JSUB by running to the instruction that follows it
+func (s *Server) next(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	pc := s.cpu.GetRegister(processor.RegPC)
+	inst, err := disasm.Decode(s.ram, pc)
+	if err != nil || inst.Mnemonic != "JSUB" {
+		return s.stepIn(args)
+	}
+
+	s.mx.Lock()
+	depth := len(s.stack)
+	s.mx.Unlock()
+
+	s.runTo(pc+inst.Length, depth)
+	return nil, nil
+}
+
+// Runs until the current subroutine returns with RSUB
+func (s *Server) stepOut(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	s.mx.Lock()
+	depth := len(s.stack) - 1
+	var call frame
+	if depth >= 0 {
+		call = s.stack[depth]
+	}
+	s.mx.Unlock()
+
+	if depth < 0 {
+		return nil, errors.New("Not in a subroutine")
+	}
+
+	inst, err := disasm.Decode(s.ram, call.call)
+	if err != nil {
+		return nil, err
+	}
+
+	s.runTo(call.call+inst.Length, depth)
+	return nil, nil
+}
+
+// Runs the CPU until it reaches addr with at most depth calls on the stack
+func (s *Server) runTo(addr int32, depth int) {
+	id := s.cpu.Breakpoints.Add(&processor.Breakpoint{Kind: processor.BreakExecute, Address: addr})
+
+	s.mx.Lock()
+	s.stepping = &step{breakpoint: id, depth: depth}
+	s.mx.Unlock()
+
+	s.after = s.cpu.Start
+}
+
+func (s *Server) stepBack(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+	if err := s.cpu.StepBack(); err != nil {
+		return nil, err
+	}
+
+	s.after = func() {
+		s.sendStopped("step", "", nil)
+	}
+	return nil, nil
+}
+
+// Runs backwards to the previous breakpoint or the oldest recorded instruction
+func (s *Server) reverseContinue(args json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	reason, err := s.cpu.ReverseContinue()
+	if err != nil {
+		return nil, err
+	}
+
+	s.after = func() {
+		if reason.Kind == processor.StopBreakpoint {
+			s.sendStopped("breakpoint", "", []int{reason.Breakpoint.ID})
+		} else {
+			s.sendStopped("step", "", nil)
+		}
+	}
+	return nil, nil
+}
+
+func (s *Server) disconnect(args json.RawMessage) (interface{}, error) {
+	s.mx.Lock()
+	s.done = true
+	s.mx.Unlock()
+
+	if s.cpu != nil {
+		s.cpu.Stop()
+	}
+	s.after = func() {
+		s.conn.event("terminated", nil)
+	}
+	return nil, nil
+}
@@ -0,0 +1,250 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uroshercog/sic-machine/asm"
+)
+
+const source = `MAIN    START   0
+        LDA     #72
+        WD      #1
+        LDA     #10
+        WD      #1
+        JSUB    SUB
+HALT    J       HALT
+SUB     LDA     #5
+        RSUB
+        END     MAIN
+`
+
+// Message from the adapter, a response or an event
+type message struct {
+	Type       string          `json:"type"`
+	Event      string          `json:"event"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type client struct {
+	t        *testing.T
+	w        io.Writer
+	seq      int
+	messages chan *message
+}
+
+// Assembles the program with its listing into a temporary directory and
+// starts an adapter for it
+func newClient(t *testing.T) (*client, string) {
+	program, err := asm.Assemble(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, write := range map[string]func(io.Writer) error{
+		"main.obj": program.WriteObject,
+		"main.lst": program.WriteListing,
+	} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := write(f); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	requests, w := io.Pipe()
+	r, responses := io.Pipe()
+	go NewServer(requests, responses).Serve()
+
+	c := &client{t: t, w: w, messages: make(chan *message, 100)}
+	go func() {
+		tr := textproto.NewReader(bufio.NewReader(r))
+		for {
+			header, err := tr.ReadMIMEHeader()
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			data := make([]byte, length)
+			io.ReadFull(tr.R, data)
+			msg := &message{}
+			json.Unmarshal(data, msg)
+			c.messages <- msg
+		}
+	}()
+	return c, filepath.Join(dir, "main.obj")
+}
+
+// Waits for the next message, which must be of the type and name
+func (c *client) expect(typ, name string) *message {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatalf("adapter closed, want %s %s", typ, name)
+		}
+		if msg.Type != typ || typ == "event" && msg.Event != name {
+			c.t.Fatalf("received %s %s %s, want %s %s", msg.Type, msg.Event, msg.Body, typ, name)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("no %s %s", typ, name)
+	}
+	return nil
+}
+
+// Sends a request and returns its response
+func (c *client) send(command string, args interface{}) *message {
+	c.t.Helper()
+	c.seq++
+	data, _ := json.Marshal(map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return c.expect("response", command)
+}
+
+// Sends a request that has to succeed, the body of the response is decoded into body
+func (c *client) request(command string, args interface{}, body interface{}) {
+	c.t.Helper()
+	msg := c.send(command, args)
+	if !msg.Success || msg.RequestSeq != c.seq {
+		c.t.Fatalf("%s failed: %s", command, msg.Message)
+	}
+	if body != nil {
+		if err := json.Unmarshal(msg.Body, body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// Waits for a stopped event and returns its reason
+func (c *client) stopped() string {
+	c.t.Helper()
+	body := struct{ Reason string }{}
+	json.Unmarshal(c.expect("event", "stopped").Body, &body)
+	return body.Reason
+}
+
+// Returns the names of the frames on the stack
+func (c *client) stack() []string {
+	c.t.Helper()
+	trace := struct {
+		StackFrames []struct {
+			Name string
+			Line int
+		}
+	}{}
+	c.request("stackTrace", map[string]int{"threadId": threadID}, &trace)
+
+	var names []string
+	for _, f := range trace.StackFrames {
+		names = append(names, fmt.Sprintf("%s:%d", f.Name, f.Line))
+	}
+	return names
+}
+
+func TestSession(t *testing.T) {
+	c, program := newClient(t)
+
+	c.request("initialize", map[string]string{"adapterID": "sic"}, nil)
+	c.request("launch", map[string]interface{}{"program": program, "stopOnEntry": true, "journal": 10, "speed": 0}, nil)
+	c.expect("event", "initialized")
+
+	breakpoints := struct {
+		Breakpoints []struct{ Verified bool }
+	}{}
+	c.request("setFunctionBreakpoints", map[string]interface{}{
+		"breakpoints": []map[string]string{{"name": "SUB"}, {"name": "MISSING"}},
+	}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 2 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[1].Verified {
+		t.Errorf("breakpoints %+v, want only SUB verified", breakpoints.Breakpoints)
+	}
+
+	c.request("configurationDone", nil, nil)
+	if reason := c.stopped(); reason != "entry" {
+		t.Fatalf("stopped on %s, want entry", reason)
+	}
+
+	// Writes to device 1 are sent as output of the debuggee
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	output := struct{ Category, Output string }{}
+	json.Unmarshal(c.expect("event", "output").Body, &output)
+	if output.Category != "stdout" || output.Output != "H\n" {
+		t.Errorf("output %+v", output)
+	}
+	if reason := c.stopped(); reason != "breakpoint" {
+		t.Fatalf("stopped on %s, want the breakpoint", reason)
+	}
+	if stack := c.stack(); strings.Join(stack, " ") != "SUB:8 MAIN:6" {
+		t.Errorf("stack %v in the subroutine", stack)
+	}
+
+	c.request("stepOut", map[string]int{"threadId": threadID}, nil)
+	if reason := c.stopped(); reason != "step" {
+		t.Fatalf("stopped on %s, want a step", reason)
+	}
+	if stack := c.stack(); strings.Join(stack, " ") != "MAIN:7" {
+		t.Errorf("stack %v after stepping out", stack)
+	}
+
+	// Undoing RSUB returns into the subroutine
+	c.request("stepBack", map[string]int{"threadId": threadID}, nil)
+	c.stopped()
+	if stack := c.stack(); strings.Join(stack, " ") != "SUB:9 MAIN:6" {
+		t.Errorf("stack %v after stepping back", stack)
+	}
+
+	c.request("disconnect", nil, nil)
+	c.expect("event", "terminated")
+}
+
+func TestRequestErrors(t *testing.T) {
+	c, _ := newClient(t)
+
+	if msg := c.send("next", nil); msg.Success || msg.Message != errNotLaunched.Error() {
+		t.Errorf("next before launch: %+v", msg)
+	}
+
+	if msg := c.send("magic", nil); msg.Success || msg.Message != `Unsupported request "magic"` {
+		t.Errorf("unknown request: %+v", msg)
+	}
+}
+
+func TestParseListing(t *testing.T) {
+	program, err := asm.Assemble(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	program.WriteListing(&b)
+
+	listing, err := ParseListing(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr, ok := listing.Symbols["SUB"]; !ok || addr != program.Symbols["SUB"] {
+		t.Errorf("SUB at %06X, want %06X", addr, program.Symbols["SUB"])
+	}
+	// A line without code maps to the next instruction
+	if addr, line, ok := listing.Address(1); !ok || addr != 0 || line != 2 {
+		t.Errorf("line 1 maps to %06X on line %d", addr, line)
+	}
+	if line := listing.Line(program.Symbols["HALT"]); line == nil || line.Number != 7 {
+		t.Errorf("HALT on line %v, want 7", line)
+	}
+}
@@ -0,0 +1,240 @@
+package dap
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/processor"
+	"github.com/uroshercog/sic-machine/processor/registers"
+)
+
+// Variable references of the scopes
+const (
+	refRegisters = 1
+	refMemory    = 2
+)
+
+// Bytes in a row of the memory scope
+const rowSize = 16
+
+var registerNames = []string{"A", "X", "L", "B", "S", "T", "F", "PC", "SW"}
+
+func registerIndex(name string) (int, bool) {
+	for i, n := range registerNames {
+		if strings.EqualFold(n, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Every frame sees the same registers and memory
+func (s *Server) scopes(raw json.RawMessage) (interface{}, error) {
+	return map[string]interface{}{
+		"scopes": []map[string]interface{}{
+			{
+				"name":               "Registers",
+				"presentationHint":   "registers",
+				"variablesReference": refRegisters,
+			},
+			{
+				"name":               "Memory",
+				"variablesReference": refMemory,
+				"indexedVariables":   memory.MaxAddress / rowSize,
+				"expensive":          true,
+			},
+		},
+	}, nil
+}
+
+type variablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+	Start              int `json:"start"`
+	Count              int `json:"count"`
+}
+
+func (s *Server) variables(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &variablesArguments{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	vars := []map[string]interface{}{}
+	switch args.VariablesReference {
+	case refRegisters:
+		for i, name := range registerNames {
+			vars = append(vars, variable(name, s.registerValue(i)))
+		}
+	case refMemory:
+		rows := memory.MaxAddress / rowSize
+		if args.Count == 0 || args.Start+args.Count > rows {
+			args.Count = rows - args.Start
+		}
+
+		raw := s.ram.GetRaw()
+		for row := args.Start; row < args.Start+args.Count; row++ {
+			addr := row * rowSize
+			vars = append(vars, variable(fmt.Sprintf("%06X", addr), fmt.Sprintf("% X", raw[addr:addr+rowSize])))
+		}
+	default:
+		return nil, fmt.Errorf("Unknown variables reference %d", args.VariablesReference)
+	}
+
+	return map[string]interface{}{"variables": vars}, nil
+}
+
+func variable(name, value string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":               name,
+		"value":              value,
+		"variablesReference": 0,
+	}
+}
+
+func (s *Server) registerValue(r int) string {
+	if r == processor.RegF {
+		return fmt.Sprintf("%g", registers.DecodeFloat(s.cpu.GetFloatBits()))
+	}
+	value := s.cpu.GetRegister(r)
+	return fmt.Sprintf("0x%06X (%d)", uint32(value)&0xFFFFFF, value)
+}
+
+type setVariableArguments struct {
+	VariablesReference int    `json:"variablesReference"`
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+}
+
+// Sets a register or a row of memory given as hex bytes
+func (s *Server) setVariable(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &setVariableArguments{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	switch args.VariablesReference {
+	case refRegisters:
+		r, ok := registerIndex(args.Name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown register %q", args.Name)
+		}
+
+		if r == processor.RegF {
+			value, err := strconv.ParseFloat(strings.TrimSpace(args.Value), 64)
+			if err != nil {
+				return nil, err
+			}
+			s.cpu.SetFloatBits(registers.EncodeFloat(value))
+		} else {
+			// The decimal part of a displayed value is not needed
+			value, err := strconv.ParseInt(strings.Fields(args.Value + " ")[0], 0, 32)
+			if err != nil {
+				return nil, err
+			}
+			s.cpu.SetRegister(r, registers.ToWord(int32(value)))
+		}
+		return map[string]interface{}{"value": s.registerValue(r)}, nil
+
+	case refMemory:
+		addr, err := strconv.ParseUint(args.Name, 16, 32)
+		if err != nil || addr%rowSize != 0 || addr >= memory.MaxAddress {
+			return nil, fmt.Errorf("Invalid row %q", args.Name)
+		}
+		values, err := hex.DecodeString(strings.Join(strings.Fields(args.Value), ""))
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != rowSize {
+			return nil, fmt.Errorf("A row has %d bytes", rowSize)
+		}
+
+		copy(s.ram.GetRaw()[addr:], values)
+		return map[string]interface{}{"value": fmt.Sprintf("% X", values)}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown variables reference %d", args.VariablesReference)
+}
+
+type memoryArguments struct {
+	MemoryReference string `json:"memoryReference"`
+	Offset          int32  `json:"offset"`
+	Count           int32  `json:"count"`
+	Data            string `json:"data"`
+}
+
+// The debugger bypasses storage keys and watchpoints
+func (s *Server) readMemory(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &memoryArguments{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseAddress(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	addr += args.Offset
+
+	// Bytes outside of the memory are unreadable
+	start, end := clamp(addr), clamp(addr+args.Count)
+	return map[string]interface{}{
+		"address":         fmt.Sprintf("0x%06X", start),
+		"data":            base64.StdEncoding.EncodeToString(s.ram.GetRaw()[start:end]),
+		"unreadableBytes": args.Count - (end - start),
+	}, nil
+}
+
+func (s *Server) writeMemory(raw json.RawMessage) (interface{}, error) {
+	if s.cpu == nil {
+		return nil, errNotLaunched
+	}
+
+	args := &memoryArguments{}
+	if err := json.Unmarshal(raw, args); err != nil {
+		return nil, err
+	}
+
+	addr, err := parseAddress(args.MemoryReference)
+	if err != nil {
+		return nil, err
+	}
+	addr += args.Offset
+
+	values, err := base64.StdEncoding.DecodeString(args.Data)
+	if err != nil {
+		return nil, err
+	}
+	if addr < 0 || int64(addr)+int64(len(values)) > memory.MaxAddress {
+		return nil, fmt.Errorf("Address %#x out of range", addr)
+	}
+
+	copy(s.ram.GetRaw()[addr:], values)
+	return map[string]interface{}{"bytesWritten": len(values)}, nil
+}
+
+func clamp(addr int32) int32 {
+	if addr < 0 {
+		return 0
+	}
+	if addr > memory.MaxAddress {
+		return memory.MaxAddress
+	}
+	return addr
+}
@@ -0,0 +1,258 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uroshercog/sic-machine/memory"
+)
+
+// ChannelCount is the number of I/O channels
+const ChannelCount = 16
+
+// CommandSize is the size of a channel command in bytes. Channel programs are
+// sequences of commands, each laid out as:
+//
+//	byte 0      command (ChannelHalt, ChannelRead or ChannelWrite)
+//	byte 1      device number
+//	byte 2      unused
+//	bytes 3-5   number of bytes to transfer
+//	bytes 6-8   memory address of the data
+const CommandSize = 9
+
+// Channel commands
+const (
+	ChannelHalt  = 0x00
+	ChannelRead  = 0x01
+	ChannelWrite = 0x02
+)
+
+// ChannelStatus ...
+type ChannelStatus byte
+
+const (
+	// ChannelIdle means the channel is ready to start a program
+	ChannelIdle ChannelStatus = iota
+	// ChannelBusy means a channel program is running
+	ChannelBusy
+	// ChannelError means the last channel program was aborted because of an error
+	ChannelError
+)
+
+const (
+	errInvalidChannel = "Invalid channel"
+	errInvalidCommand = "Invalid channel command"
+)
+
+type channel struct {
+	status  ChannelStatus
+	program int32
+	command byte
+	fd      byte
+	device  Device
+	addr    int32
+	count   int32
+	err     error
+}
+
+// ChannelState is the state of a channel saved in snapshots
+type ChannelState struct {
+	Status  ChannelStatus
+	Program int32
+	Command byte
+	Device  byte
+	Addr    int32
+	Count   int32
+	Err     string
+}
+
+// ChannelManager runs channel programs alongside the CPU, moving blocks of
+// data between the memory and the devices
+type ChannelManager struct {
+	channels [ChannelCount]channel
+	ram      *memory.RAM
+	devices  *DeviceManager
+	// Number of bytes each channel transfers per tick
+	Rate       int32
+	OnComplete []func(channel byte)
+}
+
+// Start starts the channel program at addr, it returns false if the channel is busy
+func (cm *ChannelManager) Start(n byte, addr int32) bool {
+	ch := cm.get(n)
+	if ch.status == ChannelBusy {
+		return false
+	}
+
+	*ch = channel{status: ChannelBusy, program: addr}
+	return true
+}
+
+// Halt aborts the channel program and returns the status the channel had
+func (cm *ChannelManager) Halt(n byte) ChannelStatus {
+	ch := cm.get(n)
+	status := ch.status
+	*ch = channel{status: ChannelIdle}
+	return status
+}
+
+// Status ...
+func (cm *ChannelManager) Status(n byte) ChannelStatus {
+	return cm.get(n).status
+}
+
+// Err returns the error that aborted the last channel program
+func (cm *ChannelManager) Err(n byte) error {
+	return cm.get(n).err
+}
+
+// Tick advances every busy channel by up to Rate bytes
+func (cm *ChannelManager) Tick() {
+	for i := range cm.channels {
+		ch := &cm.channels[i]
+		if ch.status != ChannelBusy {
+			continue
+		}
+
+		if err := cm.advance(ch); err != nil {
+			ch.status = ChannelError
+			ch.err = err
+		}
+
+		if ch.status != ChannelBusy {
+			for _, f := range cm.OnComplete {
+				f(byte(i))
+			}
+		}
+	}
+}
+
+func (cm *ChannelManager) advance(ch *channel) error {
+	if ch.count == 0 {
+		// Fetch the next command of the channel program
+		cmd, err := cm.read(ch.program, CommandSize)
+		if err != nil {
+			return err
+		}
+		ch.program += CommandSize
+
+		ch.command = cmd[0]
+		ch.fd = cmd[1]
+		ch.count = int32(cmd[3])<<16 | int32(cmd[4])<<8 | int32(cmd[5])
+		ch.addr = int32(cmd[6])<<16 | int32(cmd[7])<<8 | int32(cmd[8])
+
+		switch ch.command {
+		case ChannelHalt:
+			ch.status = ChannelIdle
+			return nil
+		case ChannelRead, ChannelWrite:
+			if ch.device, err = cm.devices.Get(ch.fd); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s %#02x", errInvalidCommand, ch.command)
+		}
+	}
+
+	for i := int32(0); i < cm.Rate && ch.count > 0; i++ {
+		cell, err := cm.read(ch.addr, 1)
+		if err != nil {
+			return err
+		}
+
+		if ch.command == ChannelRead {
+			value, err := cm.devices.Read(ch.fd)
+			if err != nil {
+				return err
+			}
+			cm.ram.StoreByte(ch.addr, value)
+		} else if err := ch.device.Write(cell[0]); err != nil {
+			return err
+		}
+
+		ch.addr++
+		ch.count--
+	}
+	return nil
+}
+
+// SaveState returns the state of every channel
+func (cm *ChannelManager) SaveState() []ChannelState {
+	states := make([]ChannelState, ChannelCount)
+	for i, ch := range cm.channels {
+		states[i] = ChannelState{
+			Status:  ch.status,
+			Program: ch.program,
+			Command: ch.command,
+			Device:  ch.fd,
+			Addr:    ch.addr,
+			Count:   ch.count,
+		}
+		if ch.err != nil {
+			states[i].Err = ch.err.Error()
+		}
+	}
+	return states
+}
+
+// LoadState restores the channels saved by SaveState
+func (cm *ChannelManager) LoadState(states []ChannelState) error {
+	if len(states) != ChannelCount {
+		return fmt.Errorf("Expected the state of %d channels, got %d", ChannelCount, len(states))
+	}
+
+	var channels [ChannelCount]channel
+	for i, st := range states {
+		ch := channel{
+			status:  st.Status,
+			program: st.Program,
+			command: st.Command,
+			fd:      st.Device,
+			addr:    st.Addr,
+			count:   st.Count,
+		}
+		if st.Err != "" {
+			ch.err = errors.New(st.Err)
+		}
+
+		// A transfer in progress continues on its device
+		if ch.status == ChannelBusy && ch.count > 0 {
+			d, err := cm.devices.Get(ch.fd)
+			if err != nil {
+				return err
+			}
+			ch.device = d
+		}
+		channels[i] = ch
+	}
+
+	cm.channels = channels
+	return nil
+}
+
+// Channels access the memory directly, without the protection checks of the CPU.
+// Writes go through StoreByte so that they are journaled and watched.
+func (cm *ChannelManager) read(addr, length int32) ([]byte, error) {
+	cells := cm.ram.GetRaw()
+	if addr < 0 || addr+length > int32(len(cells)) {
+		return nil, fmt.Errorf("Invalid memory address %#x", addr)
+	}
+	return cells[addr : addr+length], nil
+}
+
+func (cm *ChannelManager) get(n byte) *channel {
+	if int(n) >= ChannelCount {
+		panic(errors.New(errInvalidChannel))
+	}
+	return &cm.channels[n]
+}
+
+// NewChannelManager ...
+func NewChannelManager(ram *memory.RAM, devices *DeviceManager) *ChannelManager {
+	return &ChannelManager{
+		ram:        ram,
+		devices:    devices,
+		Rate:       16,
+		OnComplete: []func(channel byte){},
+	}
+}
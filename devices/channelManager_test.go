@@ -0,0 +1,158 @@
+package devices
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/uroshercog/sic-machine/memory"
+)
+
+// Device that reads the bytes of data and records the writes
+type bufferDevice struct {
+	data    []byte
+	written []byte
+}
+
+func (bd *bufferDevice) Read() (byte, error) {
+	if len(bd.data) == 0 {
+		return 0, ErrNotReady
+	}
+	value := bd.data[0]
+	bd.data = bd.data[1:]
+	return value, nil
+}
+
+func (bd *bufferDevice) Write(value byte) error {
+	bd.written = append(bd.written, value)
+	return nil
+}
+
+func (bd *bufferDevice) Test() bool {
+	return len(bd.data) > 0
+}
+
+// Lays out a channel command at addr
+func putCommand(ram *memory.RAM, addr int32, command, fd byte, count, data int32) {
+	cells := ram.GetRaw()
+	copy(cells[addr:], []byte{command, fd, 0,
+		byte(count >> 16), byte(count >> 8), byte(count),
+		byte(data >> 16), byte(data >> 8), byte(data)})
+}
+
+func newChannels() (*ChannelManager, *memory.RAM, *bufferDevice) {
+	ram := memory.New()
+	devices := New()
+	device := &bufferDevice{data: []byte("channel")}
+	devices.Set(5, device)
+	return NewChannelManager(ram, devices), ram, device
+}
+
+func TestChannelProgram(t *testing.T) {
+	cm, ram, device := newChannels()
+	cm.Rate = 2
+
+	putCommand(ram, 0x100, ChannelRead, 5, 4, 0x200)
+	putCommand(ram, 0x109, ChannelWrite, 5, 3, 0x201)
+	putCommand(ram, 0x112, ChannelHalt, 0, 0, 0)
+
+	var written []int32
+	ram.OnWrite = append(ram.OnWrite, func(addr int32, value byte) {
+		written = append(written, addr)
+	})
+	var completed []byte
+	cm.OnComplete = append(cm.OnComplete, func(n byte) {
+		completed = append(completed, n)
+	})
+
+	if !cm.Start(3, 0x100) {
+		t.Fatal("idle channel did not start")
+	}
+	if cm.Start(3, 0x100) {
+		t.Error("busy channel started again")
+	}
+
+	// Two bytes per tick, then the halt command
+	for i := 0; i < 5; i++ {
+		if cm.Status(3) != ChannelBusy {
+			t.Fatalf("channel finished after %d ticks", i)
+		}
+		cm.Tick()
+	}
+	if cm.Status(3) != ChannelIdle || cm.Err(3) != nil {
+		t.Fatalf("status %d, error %v", cm.Status(3), cm.Err(3))
+	}
+	if len(completed) != 1 || completed[0] != 3 {
+		t.Errorf("completed channels %v, want [3]", completed)
+	}
+
+	if got := ram.GetRaw()[0x200:0x204]; string(got) != "chan" {
+		t.Errorf("memory %q, want \"chan\"", got)
+	}
+	if string(device.written) != "han" {
+		t.Errorf("written %q, want \"han\"", device.written)
+	}
+	// Bytes read into the memory are reported like the ones the CPU writes
+	if len(written) != 4 || written[0] != 0x200 || written[3] != 0x203 {
+		t.Errorf("OnWrite called for %v", written)
+	}
+}
+
+func TestChannelErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		command byte
+		fd      byte
+		want    string
+	}{
+		{"invalid command", 0x07, 5, "Invalid channel command 0x07"},
+		{"unmapped device", ChannelRead, 0x42, "Device 42 is not mapped"},
+	}
+
+	for _, test := range tests {
+		cm, ram, _ := newChannels()
+		putCommand(ram, 0, test.command, test.fd, 1, 0x100)
+
+		cm.Start(0, 0)
+		cm.Tick()
+		if cm.Status(0) != ChannelError {
+			t.Errorf("%s: status %d, want an error", test.name, cm.Status(0))
+		} else if err := cm.Err(0); err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("%s: error %v, want %q", test.name, err, test.want)
+		}
+
+		// Halt reports the status and resets the channel
+		if status := cm.Halt(0); status != ChannelError || cm.Status(0) != ChannelIdle {
+			t.Errorf("%s: halt returned %d, status %d", test.name, status, cm.Status(0))
+		}
+	}
+}
+
+func TestChannelState(t *testing.T) {
+	cm, ram, _ := newChannels()
+	cm.Rate = 1
+	putCommand(ram, 0, ChannelRead, 5, 7, 0x100)
+	putCommand(ram, 9, ChannelHalt, 0, 0, 0)
+
+	cm.Start(1, 0)
+	cm.Tick()
+	cm.Tick()
+	states := cm.SaveState()
+
+	// The transfer continues where it was saved, on the same device
+	restored := NewChannelManager(ram, cm.devices)
+	restored.Rate = 1
+	if err := restored.LoadState(states); err != nil {
+		t.Fatal(err)
+	}
+	for restored.Status(1) == ChannelBusy {
+		restored.Tick()
+	}
+	if got := ram.GetRaw()[0x100:0x107]; !bytes.Equal(got, []byte("channel")) {
+		t.Errorf("memory %q, want \"channel\"", got)
+	}
+
+	if err := restored.LoadState(states[:2]); err == nil {
+		t.Error("state of 2 channels was loaded")
+	}
+}
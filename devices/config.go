@@ -0,0 +1,100 @@
+package devices
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadConfig reads the device mappings from a TOML file. Only the devices
+// table is read, each key is a device number and each value a device as in
+// ParseMapping:
+//
+//	[devices]
+//	00 = "builtin:stdin"
+//	05 = "file:input.txt:ro"
+//	"06" = 'file:C:\out.txt:trunc'
+func ReadConfig(r io.Reader, filename string) ([]Mapping, error) {
+	var mappings []Mapping
+	table := ""
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(stripComment(scanner.Text()))
+		if text == "" {
+			continue
+		}
+
+		fail := func(format string, a ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", filename, line, fmt.Sprintf(format, a...))
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fail("Invalid table %s", text)
+			}
+			table = strings.TrimSpace(text[1 : len(text)-1])
+			if table != "devices" {
+				return nil, fail("Unknown table %q", table)
+			}
+			continue
+		}
+
+		i := strings.Index(text, "=")
+		if i < 0 {
+			return nil, fail("Expected key = value")
+		}
+		if table == "" {
+			return nil, fail("Key outside of the devices table")
+		}
+
+		key, err := unquote(strings.TrimSpace(text[:i]), true)
+		if err != nil {
+			return nil, fail("Invalid key: %v", err)
+		}
+		value, err := unquote(strings.TrimSpace(text[i+1:]), false)
+		if err != nil {
+			return nil, fail("Invalid value: %v", err)
+		}
+
+		m, err := parseDevice(key, value)
+		if err != nil {
+			return nil, fail("%v", err)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, scanner.Err()
+}
+
+// Removes a comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+// Unquotes a basic "string" or a literal 'string', keys may also be bare
+func unquote(s string, bare bool) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, "\""):
+		return strconv.Unquote(s)
+	case bare && s != "" && !strings.ContainsAny(s, " \t\"'"):
+		return s, nil
+	}
+	return "", fmt.Errorf("Expected a string, got %s", s)
+}
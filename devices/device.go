@@ -1,11 +1,38 @@
 package devices
 
+import "errors"
+
+// ErrNotReady is returned by Read of a device that cannot wait for input
+var ErrNotReady = errors.New("Device is not ready")
+
 // Device ...
 type Device interface {
-	// Test ...
+	// Test reports whether Read or Write would not wait. A device whose input
+	// has ended is not ready, it tells so with Ended.
 	Test() bool
 	// Read ...
 	Read() (byte, error)
 	// Write ...
 	Write(value byte) error
 }
+
+// Ender is implemented by devices whose input can end
+type Ender interface {
+	// Ended reports whether all the input was read, Read then fails
+	Ended() bool
+}
+
+// Canceler is implemented by devices whose Read can wait for input
+type Canceler interface {
+	// Cancel makes a waiting Read and the ones after it fail with err once
+	// the input that was already received is read
+	Cancel(err error)
+}
+
+// Stateful is implemented by devices whose state is saved in snapshots
+type Stateful interface {
+	// SaveState ...
+	SaveState() ([]byte, error)
+	// LoadState ...
+	LoadState(data []byte) error
+}
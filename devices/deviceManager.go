@@ -1,21 +1,76 @@
 package devices
 
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+)
+
 // DeviceManager ..
 type DeviceManager struct {
 	devices map[byte]Device
+	// Bytes given back with Unread, by device number
+	pushback map[byte][]byte
+	// Called with every byte read with Read
+	OnRead []func(fd byte, value byte)
+	// Input log being recorded or replayed, see Record and Replay
+	record *bufio.Writer
+	replay *bufio.Reader
+	// Number of instructions executed, for the input log and the latency of devices
+	steps uint64
 }
 
-// Get ...
-func (dm *DeviceManager) Get(fd byte) Device {
+// Get returns the device, devices that are not mapped cannot be used
+func (dm *DeviceManager) Get(fd byte) (Device, error) {
 	if dev, ok := dm.devices[fd]; ok {
-		return dev
+		return dev, nil
+	}
+	return nil, fmt.Errorf("Device %02X is not mapped", fd)
+}
+
+// Read reads a byte from the device, bytes given back with Unread are read first
+func (dm *DeviceManager) Read(fd byte) (byte, error) {
+	var value byte
+	if pending := dm.pushback[fd]; len(pending) > 0 {
+		value = pending[0]
+		dm.pushback[fd] = pending[1:]
+	} else {
+		var err error
+		if value, err = dm.readDevice(fd); err != nil {
+			return 0, err
+		}
 	}
 
-	// TODO: Device does not exist, open it
-	// This is a file device
-	d := NewFileDevice(fd)
-	dm.devices[fd] = d
-	return d
+	for _, f := range dm.OnRead {
+		f(fd, value)
+	}
+	return value, nil
+}
+
+// Test reports whether the device is ready and whether its input has ended,
+// a device with bytes given back with Unread always is ready
+func (dm *DeviceManager) Test(fd byte) (ready bool, ended bool, err error) {
+	if len(dm.pushback[fd]) > 0 {
+		return true, false, nil
+	}
+	return dm.testDevice(fd)
+}
+
+// Cancel makes the reads that wait for input fail with err, so that an
+// instruction waiting for a device finishes. It can be called while the CPU runs.
+func (dm *DeviceManager) Cancel(err error) {
+	for _, d := range dm.devices {
+		if c, ok := d.(Canceler); ok {
+			c.Cancel(err)
+		}
+	}
+}
+
+// Unread gives a byte back to the device, it is returned by the next Read
+func (dm *DeviceManager) Unread(fd byte, value byte) {
+	dm.pushback[fd] = append([]byte{value}, dm.pushback[fd]...)
 }
 
 // Set ...
@@ -23,6 +78,61 @@ func (dm *DeviceManager) Set(fd byte, device Device) {
 	dm.devices[fd] = device
 }
 
+// Numbers returns the numbers of the devices in use, in order
+func (dm *DeviceManager) Numbers() []byte {
+	numbers := make([]byte, 0, len(dm.devices))
+	for fd := range dm.devices {
+		numbers = append(numbers, fd)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+	return numbers
+}
+
+// State of the manager saved in snapshots, the devices save their own
+type managerState struct {
+	Steps    uint64
+	Pushback map[byte][]byte
+	// Instruction at which every device with latency is ready again
+	ReadyAt map[byte]uint64
+}
+
+// SaveState saves the bytes given back with Unread and the clock of the
+// input log and of the devices with latency
+func (dm *DeviceManager) SaveState() ([]byte, error) {
+	state := managerState{Steps: dm.steps, Pushback: dm.pushback, ReadyAt: map[byte]uint64{}}
+	for fd, device := range dm.devices {
+		if ld, ok := device.(*LatencyDevice); ok {
+			state.ReadyAt[fd] = ld.readyAt
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadState restores the state saved by SaveState, the devices must be mapped first
+func (dm *DeviceManager) LoadState(data []byte) error {
+	var state managerState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+
+	dm.steps = state.Steps
+	dm.pushback = map[byte][]byte{}
+	for fd, pending := range state.Pushback {
+		dm.pushback[fd] = pending
+	}
+	for fd, readyAt := range state.ReadyAt {
+		if ld, ok := dm.devices[fd].(*LatencyDevice); ok {
+			ld.readyAt = readyAt
+		}
+	}
+	return nil
+}
+
 // New ...
 func New() *DeviceManager {
 	return &DeviceManager{
@@ -31,5 +141,7 @@ func New() *DeviceManager {
 			1: NewStdoutDevice(),
 			2: NewStderrDevice(),
 		},
+		pushback: map[byte][]byte{},
+		OnRead:   []func(fd byte, value byte){},
 	}
 }
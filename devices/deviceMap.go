@@ -0,0 +1,198 @@
+package devices
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Mapping binds a device number to a device, written as
+//
+//	05=file:input.txt:ro          file, ro, wo, trunc or append, read and write by default
+//	06=pipe:/tmp/fifo:wo          named pipe, ro, wo or rw (the default)
+//	07=socket:connect:tcp::9000   socket, tcp:host:port or unix:path
+//	07=socket:listen:unix:/tmp/s  socket accepting a single client
+//	08=null                       discards writes, reads fail
+//	00=builtin:stdin              stdin, stdout, stderr or keyboard (the console of the UI)
+//
+// Options follow the device after commas, latency=N makes the device busy for
+// N instruction cycles after every read and write:
+//
+//	05=file:input.txt:ro,latency=100
+type Mapping struct {
+	Number byte
+	// file, pipe, socket, null or builtin
+	Kind string
+	// Path of the file or pipe, address of the socket or name of the builtin device
+	Target string
+	// How a file or pipe is opened or what a socket does
+	Mode string
+	// Instruction cycles the device is busy after a read or write
+	Latency uint64
+}
+
+// Flags of os.OpenFile for the modes of files
+var fileModes = map[string]int{
+	"":       os.O_RDWR | os.O_CREATE | os.O_APPEND,
+	"ro":     os.O_RDONLY,
+	"wo":     os.O_WRONLY | os.O_CREATE,
+	"trunc":  os.O_WRONLY | os.O_CREATE | os.O_TRUNC,
+	"append": os.O_WRONLY | os.O_CREATE | os.O_APPEND,
+}
+
+// Flags of os.OpenFile for the modes of pipes
+var pipeModes = map[string]int{
+	"":   os.O_RDWR,
+	"ro": os.O_RDONLY,
+	"wo": os.O_WRONLY,
+	"rw": os.O_RDWR,
+}
+
+// ParseMapping parses a mapping in the form number=device, the number is hexadecimal
+func ParseMapping(s string) (Mapping, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return Mapping{}, fmt.Errorf("Invalid device mapping %q, expected number=device", s)
+	}
+	return parseDevice(strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]))
+}
+
+func parseDevice(number string, device string) (Mapping, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(number), "0x"), 16, 8)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("Invalid device number %q", number)
+	}
+
+	m := Mapping{Number: byte(n)}
+	if i := strings.Index(device, ","); i >= 0 {
+		if err := m.parseOptions(device[i+1:]); err != nil {
+			return Mapping{}, err
+		}
+		device = device[:i]
+	}
+
+	m.Kind = device
+	if i := strings.Index(device, ":"); i >= 0 {
+		m.Kind, m.Target = device[:i], device[i+1:]
+	}
+
+	switch m.Kind {
+	case "file":
+		m.Target, m.Mode = splitMode(m.Target, fileModes)
+	case "pipe":
+		m.Target, m.Mode = splitMode(m.Target, pipeModes)
+	case "socket":
+		i := strings.Index(m.Target, ":")
+		if i < 0 || (m.Target[:i] != "connect" && m.Target[:i] != "listen") {
+			return Mapping{}, fmt.Errorf("Invalid socket %q, expected socket:connect:address or socket:listen:address", device)
+		}
+		m.Mode, m.Target = m.Target[:i], m.Target[i+1:]
+		if _, _, err := SplitAddress(m.Target); err != nil {
+			return Mapping{}, err
+		}
+	case "null":
+		if m.Target != "" {
+			return Mapping{}, fmt.Errorf("Invalid device %q, null takes no arguments", device)
+		}
+	case "builtin":
+		if _, ok := builtins[m.Target]; !ok {
+			return Mapping{}, fmt.Errorf("Unknown builtin device %q", m.Target)
+		}
+	default:
+		return Mapping{}, fmt.Errorf("Unknown kind of device %q", m.Kind)
+	}
+
+	if (m.Kind == "file" || m.Kind == "pipe") && m.Target == "" {
+		return Mapping{}, fmt.Errorf("Invalid device %q, the path is missing", device)
+	}
+	return m, nil
+}
+
+func (m *Mapping) parseOptions(options string) error {
+	for _, option := range strings.Split(options, ",") {
+		i := strings.Index(option, "=")
+		if i < 0 {
+			return fmt.Errorf("Invalid option %q, expected name=value", option)
+		}
+
+		name, value := strings.TrimSpace(option[:i]), strings.TrimSpace(option[i+1:])
+		switch name {
+		case "latency":
+			latency, err := strconv.ParseUint(value, 0, 64)
+			if err != nil {
+				return fmt.Errorf("Invalid latency %q", value)
+			}
+			m.Latency = latency
+		default:
+			return fmt.Errorf("Unknown option %q", name)
+		}
+	}
+	return nil
+}
+
+// Splits the mode off the end of the path, if it is one of the modes
+func splitMode(target string, modes map[string]int) (string, string) {
+	i := strings.LastIndex(target, ":")
+	if i < 0 {
+		return target, ""
+	}
+	if _, ok := modes[target[i+1:]]; !ok {
+		return target, ""
+	}
+	return target[:i], target[i+1:]
+}
+
+// Builtin devices by name
+var builtins = map[string]func() Device{
+	"stdin":    func() Device { return NewStdinDevice() },
+	"stdout":   func() Device { return NewStdoutDevice() },
+	"stderr":   func() Device { return NewStderrDevice() },
+	"keyboard": func() Device { return NewKeyboardDevice() },
+}
+
+// Open opens the device of the mapping
+func (m Mapping) Open() (Device, error) {
+	switch m.Kind {
+	case "file":
+		return NewFileDevice(m.Target, fileModes[m.Mode])
+	case "pipe":
+		return NewPipeDevice(m.Target, pipeModes[m.Mode]), nil
+	case "socket":
+		if m.Mode == "listen" {
+			return ListenSocket(m.Target)
+		}
+		return DialSocket(m.Target)
+	case "null":
+		return NullDevice{}, nil
+	case "builtin":
+		return builtins[m.Target](), nil
+	}
+	return nil, fmt.Errorf("Unknown kind of device %q", m.Kind)
+}
+
+// Map opens the devices of the mappings, a later mapping of the same number
+// replaces an earlier one
+func (dm *DeviceManager) Map(mappings []Mapping) error {
+	final := map[byte]Mapping{}
+	var numbers []byte
+	for _, m := range mappings {
+		if _, ok := final[m.Number]; !ok {
+			numbers = append(numbers, m.Number)
+		}
+		final[m.Number] = m
+	}
+
+	for _, n := range numbers {
+		m := final[n]
+		d, err := m.Open()
+		if err != nil {
+			return fmt.Errorf("Device %02X: %v", n, err)
+		}
+		if m.Latency > 0 {
+			d = NewLatencyDevice(d, m.Latency, dm.clock)
+		}
+		dm.devices[n] = d
+	}
+	return nil
+}
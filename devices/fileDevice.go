@@ -1,24 +1,24 @@
 package devices
 
 import (
+	"encoding/binary"
 	"errors"
 	"os"
-	"fmt"
+	"io"
 )
 
 // FileDevice ...
 type FileDevice struct {
 	file *os.File
+	flag int
 }
 
-// NewFileDevice ..
-func NewFileDevice(device byte) *FileDevice {
-	if file, err := os.OpenFile(fmt.Sprintf("%#02x.dev", device),
-		os.O_RDWR|os.O_CREATE|os.O_APPEND,
-		os.ModePerm); err != nil {
-		panic(err)
+// NewFileDevice opens the file with the flags of os.OpenFile
+func NewFileDevice(path string, flag int) (*FileDevice, error) {
+	if file, err := os.OpenFile(path, flag, 0666); err != nil {
+		return nil, err
 	} else {
-		return &FileDevice{file}
+		return &FileDevice{file, flag}, nil
 	}
 }
 
@@ -50,7 +50,50 @@ func (fd *FileDevice) Write(value byte) error {
 	return nil
 }
 
-// Test ...
+// Test reports whether there is data left to read in a read-only file, files
+// that can be written are always ready
 func (fd *FileDevice) Test() bool {
-	return true
+	if fd.flag&(os.O_WRONLY|os.O_RDWR) != os.O_RDONLY {
+		return true
+	}
+	return !fd.Ended()
+}
+
+// Ended reports whether a regular read-only file was read to the end
+func (fd *FileDevice) Ended() bool {
+	if fd.flag&(os.O_WRONLY|os.O_RDWR) != os.O_RDONLY {
+		return false
+	}
+
+	offset, err := fd.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	info, err := fd.file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return offset >= info.Size()
+}
+
+// SaveState saves the offset in the file
+func (fd *FileDevice) SaveState() ([]byte, error) {
+	offset, err := fd.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(offset))
+	return data, nil
+}
+
+// LoadState seeks to the saved offset, writes still append to the file
+func (fd *FileDevice) LoadState(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("Invalid file device state")
+	}
+
+	_, err := fd.file.Seek(int64(binary.BigEndian.Uint64(data)), io.SeekStart)
+	return err
 }
@@ -0,0 +1,109 @@
+package devices
+
+import (
+	"io"
+	"sync"
+)
+
+// inputBuffer reads a stream in the background, so a device can tell whether
+// a read would block
+type inputBuffer struct {
+	once     sync.Once
+	condOnce sync.Once
+	mx       sync.Mutex
+	cond     *sync.Cond
+	data     []byte
+	// Error that ended the stream, returned once the data is read
+	err error
+}
+
+// Starts reading the stream returned by open, only the first call does anything
+func (b *inputBuffer) start(open func() (io.Reader, error)) {
+	b.once.Do(func() {
+		b.init()
+		go b.fill(open)
+	})
+}
+
+func (b *inputBuffer) init() {
+	b.condOnce.Do(func() {
+		b.cond = sync.NewCond(&b.mx)
+	})
+}
+
+func (b *inputBuffer) fill(open func() (io.Reader, error)) {
+	r, err := open()
+	for err == nil {
+		chunk := make([]byte, 256)
+		var n int
+		n, err = r.Read(chunk)
+
+		b.mx.Lock()
+		b.data = append(b.data, chunk[:n]...)
+		b.mx.Unlock()
+		b.cond.Broadcast()
+	}
+
+	b.mx.Lock()
+	b.err = err
+	b.mx.Unlock()
+	b.cond.Broadcast()
+}
+
+// Returns the next byte, waiting for it if there is none yet
+func (b *inputBuffer) read() (byte, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for len(b.data) == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if len(b.data) == 0 {
+		return 0, b.err
+	}
+
+	value := b.data[0]
+	b.data = b.data[1:]
+	return value, nil
+}
+
+// Reports whether read returns without waiting
+func (b *inputBuffer) ready() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return len(b.data) > 0
+}
+
+// Reports whether the stream ended and all of it was read
+func (b *inputBuffer) ended() bool {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return len(b.data) == 0 && b.err != nil
+}
+
+// Ends the stream with err, reads waiting for more data fail
+func (b *inputBuffer) cancel(err error) {
+	b.init()
+	b.mx.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.mx.Unlock()
+	b.cond.Broadcast()
+}
+
+// Returns the bytes read from the stream but not yet by the device
+func (b *inputBuffer) saveState() []byte {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return append([]byte(nil), b.data...)
+}
+
+// Puts the saved bytes before the ones read from the stream so far
+func (b *inputBuffer) loadState(data []byte) {
+	b.init()
+	b.mx.Lock()
+	b.data = append(append([]byte(nil), data...), b.data...)
+	b.mx.Unlock()
+	b.cond.Broadcast()
+}
@@ -0,0 +1,93 @@
+package devices
+
+import (
+	"errors"
+	"sync"
+)
+
+// KeyboardDevice is fed the keys typed into the UI. It never waits, the CPU
+// runs on the UI goroutine, so programs have to test it before reading.
+type KeyboardDevice struct {
+	mx   sync.Mutex
+	keys []byte
+}
+
+// NewKeyboardDevice ..
+func NewKeyboardDevice() *KeyboardDevice {
+	return &KeyboardDevice{}
+}
+
+// Type adds a typed key to the buffer
+func (kd *KeyboardDevice) Type(value byte) {
+	kd.mx.Lock()
+	kd.keys = append(kd.keys, value)
+	kd.mx.Unlock()
+}
+
+// Read returns the oldest typed key or ErrNotReady when none was typed
+func (kd *KeyboardDevice) Read() (byte, error) {
+	kd.mx.Lock()
+	defer kd.mx.Unlock()
+
+	if len(kd.keys) == 0 {
+		return 0, ErrNotReady
+	}
+	value := kd.keys[0]
+	kd.keys = kd.keys[1:]
+	return value, nil
+}
+
+// Write ...
+func (kd *KeyboardDevice) Write(value byte) error {
+	return errors.New("Keyboard cannot be written")
+}
+
+// Test reports whether a key is buffered
+func (kd *KeyboardDevice) Test() bool {
+	kd.mx.Lock()
+	defer kd.mx.Unlock()
+	return len(kd.keys) > 0
+}
+
+// SaveState saves the keys that were typed but not read yet
+func (kd *KeyboardDevice) SaveState() ([]byte, error) {
+	kd.mx.Lock()
+	defer kd.mx.Unlock()
+	return append([]byte(nil), kd.keys...), nil
+}
+
+// LoadState restores the unread keys, they are read before any new one
+func (kd *KeyboardDevice) LoadState(data []byte) error {
+	kd.mx.Lock()
+	defer kd.mx.Unlock()
+	kd.keys = append(append([]byte(nil), data...), kd.keys...)
+	return nil
+}
+
+// ReplaceStdin maps a keyboard in place of every device that reads the
+// standard input, also of those wrapped in a LatencyDevice, and returns all
+// the keyboards that are mapped
+func (dm *DeviceManager) ReplaceStdin() []*KeyboardDevice {
+	var keyboards []*KeyboardDevice
+	for _, fd := range dm.Numbers() {
+		device := dm.devices[fd]
+		ld, slow := device.(*LatencyDevice)
+		if slow {
+			device = ld.device
+		}
+
+		switch d := device.(type) {
+		case *StdinDevice:
+			keyboard := NewKeyboardDevice()
+			if slow {
+				ld.device = keyboard
+			} else {
+				dm.devices[fd] = keyboard
+			}
+			keyboards = append(keyboards, keyboard)
+		case *KeyboardDevice:
+			keyboards = append(keyboards, d)
+		}
+	}
+	return keyboards
+}
@@ -0,0 +1,65 @@
+package devices
+
+// LatencyDevice simulates a slow device, it is busy for a number of
+// instruction cycles after every read and write
+type LatencyDevice struct {
+	device  Device
+	latency uint64
+	// Returns the number of executed instructions
+	clock func() uint64
+	// Instruction at which the device is ready again
+	readyAt uint64
+}
+
+// NewLatencyDevice wraps the device, clock returns the number of executed instructions
+func NewLatencyDevice(device Device, latency uint64, clock func() uint64) *LatencyDevice {
+	return &LatencyDevice{device: device, latency: latency, clock: clock}
+}
+
+// Read ...
+func (ld *LatencyDevice) Read() (byte, error) {
+	ld.readyAt = ld.clock() + ld.latency
+	return ld.device.Read()
+}
+
+// Write ...
+func (ld *LatencyDevice) Write(value byte) error {
+	ld.readyAt = ld.clock() + ld.latency
+	return ld.device.Write(value)
+}
+
+// Test reports the device as busy until the latency has passed
+func (ld *LatencyDevice) Test() bool {
+	return ld.clock() >= ld.readyAt && ld.device.Test()
+}
+
+// Ended reports whether the input of the wrapped device has ended
+func (ld *LatencyDevice) Ended() bool {
+	if e, ok := ld.device.(Ender); ok {
+		return e.Ended()
+	}
+	return false
+}
+
+// Cancel ends a wait of the wrapped device
+func (ld *LatencyDevice) Cancel(err error) {
+	if c, ok := ld.device.(Canceler); ok {
+		c.Cancel(err)
+	}
+}
+
+// SaveState saves the state of the wrapped device
+func (ld *LatencyDevice) SaveState() ([]byte, error) {
+	if s, ok := ld.device.(Stateful); ok {
+		return s.SaveState()
+	}
+	return nil, nil
+}
+
+// LoadState restores the state of the wrapped device
+func (ld *LatencyDevice) LoadState(data []byte) error {
+	if s, ok := ld.device.(Stateful); ok {
+		return s.LoadState(data)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package devices
+
+import "io"
+
+// NullDevice discards everything written to it and has nothing to read
+type NullDevice struct{}
+
+// Read ...
+func (NullDevice) Read() (byte, error) {
+	return 0, io.EOF
+}
+
+// Write ...
+func (NullDevice) Write(value byte) error {
+	return nil
+}
+
+// Test ...
+func (NullDevice) Test() bool {
+	return true
+}
@@ -0,0 +1,108 @@
+package devices
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// PipeDevice reads from or writes to a named pipe. The pipe is opened on
+// first use, as opening it blocks until the other end is opened too.
+type PipeDevice struct {
+	path string
+	flag int
+	mx   sync.Mutex
+	file *os.File
+	// The pipe is read in the background, so Test does not block
+	input inputBuffer
+}
+
+// NewPipeDevice creates a device for the named pipe, flag is os.O_RDONLY,
+// os.O_WRONLY or os.O_RDWR
+func NewPipeDevice(path string, flag int) *PipeDevice {
+	return &PipeDevice{path: path, flag: flag}
+}
+
+func (pd *PipeDevice) open() (*os.File, error) {
+	pd.mx.Lock()
+	defer pd.mx.Unlock()
+
+	if pd.file != nil {
+		return pd.file, nil
+	}
+
+	file, err := os.OpenFile(pd.path, pd.flag, 0)
+	if err != nil {
+		return nil, err
+	}
+	pd.file = file
+	return file, nil
+}
+
+func (pd *PipeDevice) start() {
+	pd.input.start(func() (io.Reader, error) {
+		return pd.open()
+	})
+}
+
+// Read ...
+func (pd *PipeDevice) Read() (byte, error) {
+	if pd.flag == os.O_WRONLY {
+		return 0, errors.New("Pipe is write-only")
+	}
+
+	pd.start()
+	return pd.input.read()
+}
+
+// Write ...
+func (pd *PipeDevice) Write(value byte) error {
+	file, err := pd.open()
+	if err != nil {
+		return err
+	}
+
+	if bytesWritten, err := file.Write([]byte{value}); err != nil {
+		return err
+	} else if bytesWritten <= 0 {
+		return errors.New("No bytes written to the device")
+	}
+	return nil
+}
+
+// Test reports whether there is input to read, a write-only pipe is always ready
+func (pd *PipeDevice) Test() bool {
+	if pd.flag == os.O_WRONLY {
+		return true
+	}
+
+	pd.start()
+	return pd.input.ready()
+}
+
+// Cancel ends a wait for data from the pipe
+func (pd *PipeDevice) Cancel(err error) {
+	pd.input.cancel(err)
+}
+
+// Ended reports whether the writer closed the pipe and all of it was read
+func (pd *PipeDevice) Ended() bool {
+	if pd.flag == os.O_WRONLY {
+		return false
+	}
+
+	pd.start()
+	return pd.input.ended()
+}
+
+// SaveState saves the bytes taken from the pipe that the program has not read
+func (pd *PipeDevice) SaveState() ([]byte, error) {
+	return pd.input.saveState(), nil
+}
+
+// LoadState gives the saved bytes back, the pipe is read after them
+func (pd *PipeDevice) LoadState(data []byte) error {
+	pd.input.loadState(data)
+	return nil
+}
@@ -0,0 +1,196 @@
+package devices
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version of the input log format
+const InputLogVersion = 1
+
+var inputLogMagic = []byte("SICINPUT")
+
+// Kinds of input log entries, the value of a test is 1 if the device was ready
+// and 2 if its input had ended
+const (
+	inputRead byte = 'R'
+	inputTest byte = 'T'
+)
+
+var inputKinds = map[byte]string{
+	inputRead: "read",
+	inputTest: "test",
+}
+
+// Entry of an input log, written as an uvarint instruction count followed by
+// the kind, the device number and the value
+type inputEntry struct {
+	step  uint64
+	kind  byte
+	fd    byte
+	value byte
+}
+
+// Record logs every byte read from the devices and every test of their
+// readiness into w, with the device number and the number of instructions
+// executed before it
+func (dm *DeviceManager) Record(w io.Writer) error {
+	if dm.replay != nil {
+		return errors.New("Input is being replayed")
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(inputLogMagic)
+	bw.WriteByte(InputLogVersion)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	dm.record = bw
+	return nil
+}
+
+// Replay reads the bytes and the readiness from an input log made with Record
+// instead of the devices. Reads and tests that do not match the log fail.
+func (dm *DeviceManager) Replay(r io.Reader) error {
+	if dm.record != nil {
+		return errors.New("Input is being recorded")
+	}
+
+	br := bufio.NewReader(r)
+	header := make([]byte, len(inputLogMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return err
+	}
+	if string(header[:len(inputLogMagic)]) != string(inputLogMagic) {
+		return errors.New("Not an input log")
+	}
+	if header[len(inputLogMagic)] > InputLogVersion {
+		return fmt.Errorf("Input log version %d is newer than %d", header[len(inputLogMagic)], InputLogVersion)
+	}
+	dm.replay = br
+	return nil
+}
+
+// FinishRecording flushes the input log, it does not close the writer
+func (dm *DeviceManager) FinishRecording() error {
+	if dm.record == nil {
+		return nil
+	}
+	err := dm.record.Flush()
+	dm.record = nil
+	return err
+}
+
+// Step advances the instruction count of the input log, called by the CPU
+// after every executed instruction
+func (dm *DeviceManager) Step() {
+	dm.steps++
+}
+
+// StepBack goes back one instruction, called by the CPU when an instruction is undone
+func (dm *DeviceManager) StepBack() {
+	if dm.steps > 0 {
+		dm.steps--
+	}
+}
+
+// Returns the number of executed instructions
+func (dm *DeviceManager) clock() uint64 {
+	return dm.steps
+}
+
+// Reads a byte from the device, or from the input log when replaying
+func (dm *DeviceManager) readDevice(fd byte) (byte, error) {
+	if dm.replay != nil {
+		return dm.replayed(inputRead, fd)
+	}
+
+	d, err := dm.Get(fd)
+	if err != nil {
+		return 0, err
+	}
+	value, err := d.Read()
+	if err != nil {
+		return 0, err
+	}
+
+	if dm.record != nil {
+		dm.log(inputRead, fd, value)
+	}
+	return value, nil
+}
+
+func (dm *DeviceManager) log(kind byte, fd byte, value byte) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], dm.steps)
+	dm.record.Write(buf[:n])
+	dm.record.WriteByte(kind)
+	dm.record.WriteByte(fd)
+	dm.record.WriteByte(value)
+}
+
+// Tests the device, or returns the readiness from the input log when replaying
+func (dm *DeviceManager) testDevice(fd byte) (bool, bool, error) {
+	if dm.replay != nil {
+		value, err := dm.replayed(inputTest, fd)
+		return value == 1, value == 2, err
+	}
+
+	d, err := dm.Get(fd)
+	if err != nil {
+		return false, false, err
+	}
+	ready := d.Test()
+	ended := false
+	if e, ok := d.(Ender); ok && !ready {
+		ended = e.Ended()
+	}
+
+	if dm.record != nil {
+		var value byte
+		if ready {
+			value = 1
+		} else if ended {
+			value = 2
+		}
+		dm.log(inputTest, fd, value)
+	}
+	return ready, ended, nil
+}
+
+// Returns the next value of the input log, it must be of the kind and device
+// and at the current instruction
+func (dm *DeviceManager) replayed(kind byte, fd byte) (byte, error) {
+	e, err := dm.nextEntry()
+	if err == io.EOF {
+		return 0, fmt.Errorf("Input log ended, %s of device %02X at instruction %d", inputKinds[kind], fd, dm.steps)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if e.kind != kind || e.fd != fd || e.step != dm.steps {
+		return 0, fmt.Errorf("Replay diverged, %s of device %02X at instruction %d, the log has %s of device %02X at instruction %d",
+			inputKinds[kind], fd, dm.steps, inputKinds[e.kind], e.fd, e.step)
+	}
+	return e.value, nil
+}
+
+func (dm *DeviceManager) nextEntry() (*inputEntry, error) {
+	step, err := binary.ReadUvarint(dm.replay)
+	if err != nil {
+		return nil, err
+	}
+
+	var rest [3]byte
+	if _, err := io.ReadFull(dm.replay, rest[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return &inputEntry{step, rest[0], rest[1], rest[2]}, nil
+}
@@ -0,0 +1,152 @@
+package devices
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+// SocketDevice reads from and writes to a stream socket, either connected to
+// a server or accepted from a listener. The socket is read in the background,
+// so Test reports whether there is data to read.
+type SocketDevice struct {
+	conn net.Conn
+	// Error of accepting the connection
+	err error
+	// Closed once conn or err is set
+	connected chan struct{}
+	input     inputBuffer
+}
+
+// DialSocket connects to tcp:host:port or unix:path
+func DialSocket(addr string) (*SocketDevice, error) {
+	network, address, err := SplitAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := &SocketDevice{conn: conn, connected: make(chan struct{})}
+	close(sd.connected)
+	sd.start()
+	return sd, nil
+}
+
+// ListenSocket listens on tcp:host:port or unix:path and accepts a single
+// client in the background. Writes wait for the client to connect.
+func ListenSocket(addr string) (*SocketDevice, error) {
+	l, err := Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	sd := &SocketDevice{connected: make(chan struct{})}
+	go func() {
+		sd.conn, sd.err = l.Accept()
+		l.Close()
+		close(sd.connected)
+	}()
+	sd.start()
+	return sd, nil
+}
+
+func (sd *SocketDevice) start() {
+	sd.input.start(func() (io.Reader, error) {
+		<-sd.connected
+		if sd.err != nil {
+			return nil, sd.err
+		}
+		return sd.conn, nil
+	})
+}
+
+// SplitAddress splits tcp:host:port or unix:path into the network and the
+// address, a TCP address without the host is on localhost
+func SplitAddress(addr string) (string, string, error) {
+	i := strings.Index(addr, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("Invalid address %q, expected tcp:host:port or unix:path", addr)
+	}
+
+	network, address := addr[:i], addr[i+1:]
+	switch network {
+	case "tcp":
+		if strings.HasPrefix(address, ":") {
+			address = "localhost" + address
+		}
+	case "unix":
+	default:
+		return "", "", fmt.Errorf("Unknown network %q", network)
+	}
+	return network, address, nil
+}
+
+// Listen listens on tcp:host:port or unix:path
+func Listen(addr string) (net.Listener, error) {
+	network, address, err := SplitAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// A socket left behind by a previous run would make Listen fail
+	if network == "unix" {
+		if fi, err := os.Stat(address); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(address)
+		}
+	}
+	return net.Listen(network, address)
+}
+
+// Read waits for a byte, it fails with io.EOF once the peer closes the connection
+func (sd *SocketDevice) Read() (byte, error) {
+	return sd.input.read()
+}
+
+// Write ...
+func (sd *SocketDevice) Write(value byte) error {
+	<-sd.connected
+	if sd.err != nil {
+		return sd.err
+	}
+
+	if bytesWritten, err := sd.conn.Write([]byte{value}); err != nil {
+		return err
+	} else if bytesWritten <= 0 {
+		return errors.New("No bytes written to the device")
+	}
+	return nil
+}
+
+// Test reports whether there is data to read
+func (sd *SocketDevice) Test() bool {
+	return sd.input.ready()
+}
+
+// Cancel ends a wait for data from the peer
+func (sd *SocketDevice) Cancel(err error) {
+	sd.input.cancel(err)
+}
+
+// Ended reports whether the connection was closed or failed and all of the
+// data was read
+func (sd *SocketDevice) Ended() bool {
+	return sd.input.ended()
+}
+
+// SaveState saves the data received from the peer that was not read yet
+func (sd *SocketDevice) SaveState() ([]byte, error) {
+	return sd.input.saveState(), nil
+}
+
+// LoadState restores the unread data, it comes before whatever the new peer sends
+func (sd *SocketDevice) LoadState(data []byte) error {
+	sd.input.loadState(data)
+	return nil
+}
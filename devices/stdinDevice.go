@@ -2,17 +2,26 @@ package devices
 
 import (
 	"errors"
+	"io"
 	"os"
 )
 
 // StdinDevice ...
 type StdinDevice struct {
 	file *os.File
+	// Standard input is read in the background once the device is used
+	input inputBuffer
 }
 
 // NewStdinDevice ..
 func NewStdinDevice() *StdinDevice {
-	return &StdinDevice{os.Stdin}
+	return &StdinDevice{file: os.Stdin}
+}
+
+func (id *StdinDevice) start() {
+	id.input.start(func() (io.Reader, error) {
+		return id.file, nil
+	})
 }
 
 // Read ...
@@ -22,13 +31,8 @@ func (id *StdinDevice) Read() (byte, error) {
 		return 0, errors.New("File is nil")
 	}
 
-	bytesRead := make([]byte, 1)
-	if bytesReadCount, err := id.file.Read(bytesRead[:1]); err != nil {
-		return 0, err
-	} else if bytesReadCount <= 0 {
-		return 0, errors.New("No bytes read from the device")
-	}
-	return bytesRead[0], nil
+	id.start()
+	return id.input.read()
 }
 
 // Write ...
@@ -45,7 +49,38 @@ func (id *StdinDevice) Write(value byte) error {
 	return nil
 }
 
-// Test ...
+// Test reports whether there is input
 func (id *StdinDevice) Test() bool {
-	return true
+	if id.file == nil {
+		return true
+	}
+
+	id.start()
+	return id.input.ready()
+}
+
+// Cancel ends a wait for the standard input
+func (id *StdinDevice) Cancel(err error) {
+	id.input.cancel(err)
+}
+
+// Ended reports whether the standard input was closed and all of it was read
+func (id *StdinDevice) Ended() bool {
+	if id.file == nil {
+		return false
+	}
+
+	id.start()
+	return id.input.ended()
+}
+
+// SaveState saves the input that was received but not read yet
+func (id *StdinDevice) SaveState() ([]byte, error) {
+	return id.input.saveState(), nil
+}
+
+// LoadState restores the unread input, it is read before any new one
+func (id *StdinDevice) LoadState(data []byte) error {
+	id.input.loadState(data)
+	return nil
 }
@@ -12,7 +12,7 @@ type StdoutDevice struct {
 
 // NewStdoutDevice ..
 func NewStdoutDevice() *StdoutDevice {
-	return &StdoutDevice{os.Stdin}
+	return &StdoutDevice{os.Stdout}
 }
 
 // Read ...
@@ -0,0 +1,224 @@
+// Package disasm decodes SIC/XE instructions.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/memory"
+	oc "github.com/uroshercog/sic-machine/opcodes"
+)
+
+var (
+	registerNames = []string{"A", "X", "L", "B", "S", "T", "F", "", "PC", "SW"}
+)
+
+// InvalidOpcodeError is returned for bytes that are not an instruction
+type InvalidOpcodeError struct {
+	Address int32
+	Opcode  byte
+}
+
+func (e *InvalidOpcodeError) Error() string {
+	return fmt.Sprintf("Invalid opcode %#02x at %#06x", e.Opcode, e.Address)
+}
+
+// Instruction is a decoded instruction
+type Instruction struct {
+	Address int32
+	// Format is 1, 2, 3 or 4. SIC instructions (n = i = 0) are format 3.
+	Format   int
+	Opcode   uint8
+	Mnemonic string
+	// Addressing flags of format 3 and 4 instructions
+	N, I, X, B, P, E bool
+	// Registers or values of format 2 instructions
+	R1, R2 uint8
+	// Displacement of format 3, or the address of format 4 and SIC instructions
+	Displacement int32
+	// Target address without the index register, -1 if it depends on register B
+	Target int32
+	Length int32
+	Bytes  []byte
+}
+
+// Reader reads a byte of the instruction at addr
+type Reader func(addr int32) (byte, error)
+
+// Decode decodes the instruction at addr. Memory is read directly, without the protection checks.
+func Decode(ram *memory.RAM, addr int32) (*Instruction, error) {
+	cells := ram.GetRaw()
+	return DecodeFrom(addr, func(addr int32) (byte, error) {
+		if addr < 0 || addr >= int32(len(cells)) {
+			return 0, &memory.AddressError{Addr: addr}
+		}
+		return cells[addr], nil
+	})
+}
+
+// DecodeFrom decodes the instruction at addr, reading its bytes in order with read
+func DecodeFrom(addr int32, read Reader) (*Instruction, error) {
+	inst := &Instruction{Address: addr, Target: -1}
+
+	next := func() (byte, error) {
+		b, err := read(addr + inst.Length)
+		if err == nil {
+			inst.Bytes = append(inst.Bytes, b)
+			inst.Length++
+		}
+		return b, err
+	}
+
+	command, err := next()
+	if err != nil {
+		return nil, err
+	}
+
+	op, ok := oc.ByCode[command&0xFC]
+	if !ok || op.Format != 3 && command != op.Code {
+		return inst, &InvalidOpcodeError{addr, command}
+	}
+
+	inst.Opcode = op.Code
+	inst.Mnemonic = op.Mnemonic
+	inst.Format = op.Format
+
+	switch op.Format {
+	case 1:
+		return inst, nil
+	case 2:
+		operand, err := next()
+		if err != nil {
+			return nil, err
+		}
+		inst.R1 = operand >> 4
+		inst.R2 = operand & 0xF
+		return inst, nil
+	}
+
+	inst.N = command&0x2 != 0
+	inst.I = command&0x1 != 0
+
+	var operand [2]byte
+	for i := range operand {
+		if operand[i], err = next(); err != nil {
+			return nil, err
+		}
+	}
+	field := int32(operand[0])<<8 | int32(operand[1])
+	inst.X = field&0x8000 != 0
+
+	if !inst.N && !inst.I {
+		// SIC format, the address is the bottom 15 bits
+		inst.Displacement = field & 0x7FFF
+		inst.Target = inst.Displacement
+		return inst, nil
+	}
+
+	inst.B = field&0x4000 != 0
+	inst.P = field&0x2000 != 0
+	inst.E = field&0x1000 != 0
+
+	if inst.E {
+		// Format 4, the address is the bottom 20 bits
+		last, err := next()
+		if err != nil {
+			return nil, err
+		}
+		inst.Format = 4
+		inst.Displacement = (field&0xFFF)<<8 | int32(last)
+		inst.Target = inst.Displacement
+		return inst, nil
+	}
+
+	inst.Displacement = field & 0xFFF
+	switch {
+	case inst.B && inst.P:
+		// Invalid, Resolve reports it
+	case inst.P:
+		disp := inst.Displacement
+		if disp >= 2048 {
+			disp -= 4096
+		}
+		inst.Target = addr + inst.Length + disp
+	case !inst.B:
+		inst.Target = inst.Displacement
+	}
+	return inst, nil
+}
+
+// Resolve returns the target address of a format 3 or 4 instruction for
+// the given values of registers B and X
+func (inst *Instruction) Resolve(b, x int32) (int32, error) {
+	if inst.B && inst.P {
+		return 0, fmt.Errorf("Invalid addressing: PC and base")
+	}
+
+	target := inst.Target
+	if inst.B {
+		target = b + inst.Displacement
+	}
+
+	if inst.X {
+		if inst.N != inst.I {
+			return 0, fmt.Errorf("Invalid addressing: indexed")
+		}
+		target += x
+	}
+	return target, nil
+}
+
+// String renders the instruction in assembler syntax
+func (inst *Instruction) String() string {
+	if inst.Mnemonic == "" {
+		return fmt.Sprintf("BYTE X'%X'", inst.Bytes)
+	}
+
+	op := oc.Table[inst.Mnemonic]
+	switch op.Operands {
+	case oc.OperandsNone:
+		return inst.Mnemonic
+	case oc.OperandsR1R2:
+		return fmt.Sprintf("%s %s,%s", inst.Mnemonic, register(inst.R1), register(inst.R2))
+	case oc.OperandsR1:
+		return fmt.Sprintf("%s %s", inst.Mnemonic, register(inst.R1))
+	case oc.OperandsN:
+		return fmt.Sprintf("%s %d", inst.Mnemonic, inst.R1)
+	case oc.OperandsR1N:
+		return fmt.Sprintf("%s %s,%d", inst.Mnemonic, register(inst.R1), inst.R2+1)
+	}
+
+	var sb strings.Builder
+	if inst.Format == 4 {
+		sb.WriteString("+")
+	}
+	sb.WriteString(inst.Mnemonic)
+	sb.WriteString(" ")
+
+	if inst.I && !inst.N {
+		sb.WriteString("#")
+	} else if inst.N && !inst.I {
+		sb.WriteString("@")
+	}
+
+	switch {
+	case inst.Target < 0:
+		fmt.Fprintf(&sb, "B+0x%X", inst.Displacement)
+	case inst.I && !inst.N && !inst.P:
+		fmt.Fprintf(&sb, "%d", inst.Target)
+	default:
+		fmt.Fprintf(&sb, "0x%X", inst.Target)
+	}
+
+	if inst.X {
+		sb.WriteString(",X")
+	}
+	return sb.String()
+}
+
+func register(r uint8) string {
+	if int(r) < len(registerNames) && registerNames[r] != "" {
+		return registerNames[r]
+	}
+	return fmt.Sprintf("R%d", r)
+}
@@ -0,0 +1,104 @@
+package disasm
+
+import (
+	"errors"
+	"testing"
+)
+
+// Reader of the code placed at addr, reading outside of it fails
+func reader(addr int32, code []byte) Reader {
+	return func(a int32) (byte, error) {
+		if a < addr || a >= addr+int32(len(code)) {
+			return 0, errors.New("outside of the code")
+		}
+		return code[a-addr], nil
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		addr   int32
+		code   []byte
+		want   string
+		format int
+		target int32
+	}{
+		// Instructions of the COPY program, figure 2.6
+		{0x0000, []byte{0x17, 0x20, 0x2D}, "STL 0x30", 3, 0x30},
+		{0x0003, []byte{0x69, 0x20, 0x2D}, "LDB #0x33", 3, 0x33},
+		{0x0006, []byte{0x4B, 0x10, 0x10, 0x36}, "+JSUB 0x1036", 4, 0x1036},
+		{0x0017, []byte{0x3F, 0x2F, 0xEC}, "J 0x6", 3, 0x6},
+		{0x000D, []byte{0x29, 0x00, 0x00}, "COMP #0", 3, 0},
+		{0x002A, []byte{0x3E, 0x20, 0x03}, "J @0x30", 3, 0x30},
+		{0x1036, []byte{0xB4, 0x10}, "CLEAR X", 2, -1},
+		{0x103D, []byte{0x75, 0x10, 0x10, 0x00}, "+LDT #4096", 4, 4096},
+		{0x104E, []byte{0x57, 0xC0, 0x03}, "STCH B+0x3,X", 3, -1},
+		{0x1049, []byte{0xA0, 0x04}, "COMPR A,S", 2, -1},
+		{0x1052, []byte{0xB8, 0x50}, "TIXR T", 2, -1},
+		// SIC format and the other format 1 and 2 operands
+		{0x0000, []byte{0x00, 0x90, 0x00}, "LDA 0x1000,X", 3, 0x1000},
+		{0x0000, []byte{0xC4}, "FIX", 1, -1},
+		{0x0000, []byte{0xB0, 0x30}, "SVC 3", 2, -1},
+		{0x0000, []byte{0xA4, 0x03}, "SHIFTL A,4", 2, -1},
+	}
+
+	for _, test := range tests {
+		inst, err := DecodeFrom(test.addr, reader(test.addr, test.code))
+		if err != nil {
+			t.Errorf("% X: %v", test.code, err)
+			continue
+		}
+		if got := inst.String(); got != test.want {
+			t.Errorf("% X decoded as %q, want %q", test.code, got, test.want)
+		}
+		if inst.Format != test.format || inst.Length != int32(len(test.code)) || inst.Target != test.target {
+			t.Errorf("%s: format %d, length %d, target %#x", test.want, inst.Format, inst.Length, inst.Target)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	inst, err := DecodeFrom(0x10, reader(0x10, []byte{0xFF, 0x00, 0x00}))
+	if e, ok := err.(*InvalidOpcodeError); !ok || e.Address != 0x10 || e.Opcode != 0xFF {
+		t.Errorf("error %v, want an invalid opcode at 0x10", err)
+	}
+	if inst == nil || inst.String() != "BYTE X'FF'" {
+		t.Errorf("invalid opcode decoded as %v", inst)
+	}
+
+	// A format 1 opcode with the n or i bit set is not an instruction
+	if _, err := DecodeFrom(0, reader(0, []byte{0xC5})); err == nil {
+		t.Error("FIX with the i bit set was decoded")
+	}
+
+	// The instruction is cut off by the end of the code
+	if _, err := DecodeFrom(0, reader(0, []byte{0x4B, 0x10, 0x10})); err == nil {
+		t.Error("truncated format 4 instruction was decoded")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		code   []byte
+		b, x   int32
+		target int32
+		err    bool
+	}{
+		{[]byte{0x57, 0xC0, 0x03}, 0x33, 2, 0x38, false},
+		{[]byte{0x03, 0xA0, 0x10}, 0, 5, 0x18, false},
+		{[]byte{0x03, 0x60, 0x00}, 0, 0, 0, true},
+		// Indexing cannot be combined with indirect addressing
+		{[]byte{0x02, 0x80, 0x10}, 0, 1, 0, true},
+	}
+
+	for _, test := range tests {
+		inst, err := DecodeFrom(0, reader(0, test.code))
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, err := inst.Resolve(test.b, test.x)
+		if (err != nil) != test.err || err == nil && target != test.target {
+			t.Errorf("% X with B=%#x and X=%d resolved to %#x, %v", test.code, test.b, test.x, target, err)
+		}
+	}
+}
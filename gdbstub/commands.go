@@ -0,0 +1,470 @@
+package gdbstub
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Signals reported to the client
+const (
+	sigInt  = 2
+	sigIll  = 4
+	sigTrap = 5
+	sigFpe  = 8
+	sigBus  = 10
+	sigSegv = 11
+)
+
+// Registers in the order of the g packet, F is 6 bytes and the rest 3 bytes,
+// all big endian
+var registers = []struct {
+	name string
+	reg  int
+	size int
+}{
+	{"a", processor.RegA, 3},
+	{"x", processor.RegX, 3},
+	{"l", processor.RegL, 3},
+	{"b", processor.RegB, 3},
+	{"s", processor.RegS, 3},
+	{"t", processor.RegT, 3},
+	{"f", processor.RegF, 6},
+	{"pc", processor.RegPC, 3},
+	{"sw", processor.RegSW, 3},
+}
+
+var faultSignals = map[processor.FaultKind]int{
+	processor.FaultInvalidAddress:        sigSegv,
+	processor.FaultProtection:            sigSegv,
+	processor.FaultInvalidOpcode:         sigIll,
+	processor.FaultInvalidAddressing:     sigIll,
+	processor.FaultPrivilegedInstruction: sigIll,
+	processor.FaultDevice:                sigBus,
+	processor.FaultDivisionByZero:        sigFpe,
+	processor.FaultOverflow:              sigFpe,
+}
+
+// Breakpoint kinds of the Z and z packets
+var watchKinds = map[byte]processor.BreakpointKind{
+	'0': processor.BreakExecute,
+	'1': processor.BreakExecute,
+	'2': processor.BreakWrite,
+	'3': processor.BreakRead,
+	'4': processor.BreakAccess,
+}
+
+// Handles a packet and sends the reply
+func (sess *session) handle(packet string) error {
+	if sess.server.Log != nil {
+		fmt.Fprintf(sess.server.Log, "<- %s\n", packet)
+	}
+
+	if packet == "" {
+		return sess.send("")
+	}
+
+	cpu := sess.server.cpu
+	args := packet[1:]
+
+	switch packet[0] {
+	case '?':
+		return sess.send(fmt.Sprintf("S%02x", sigTrap))
+	case 'g':
+		return sess.send(sess.readRegisters())
+	case 'G':
+		return sess.reply(sess.writeRegisters(args))
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 32)
+		if err != nil || int(n) >= len(registers) {
+			return sess.send("E01")
+		}
+		return sess.send(sess.readRegister(int(n)))
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		n, err := strconv.ParseUint(parts[0], 16, 32)
+		if err != nil || len(parts) != 2 || int(n) >= len(registers) {
+			return sess.send("E01")
+		}
+		return sess.reply(sess.writeRegister(int(n), parts[1]))
+	case 'm':
+		addr, length, err := parseRange(args)
+		if err != nil {
+			return sess.send("E01")
+		}
+		return sess.send(sess.readMemory(addr, length))
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		addr, length, err := parseRange(parts[0])
+		if err != nil || len(parts) != 2 {
+			return sess.send("E01")
+		}
+		return sess.reply(sess.writeMemory(addr, length, parts[1]))
+	case 's':
+		if err := sess.resume(args); err != nil {
+			return sess.send("E01")
+		}
+		return sess.send(sess.stepReply(cpu.Exec()))
+	case 'c':
+		if err := sess.resume(args); err != nil {
+			return sess.send("E01")
+		}
+		return sess.cont()
+	case 'b':
+		return sess.reverse(args)
+	case 'Z', 'z':
+		return sess.reply(sess.breakpoint(packet[0] == 'Z', args))
+	case 'H', 'T':
+		// There is a single thread
+		return sess.send("OK")
+	case 'D':
+		sess.clearBreakpoints()
+		sess.send("OK")
+		return errDetached
+	case 'k':
+		sess.clearBreakpoints()
+		return errKilled
+	case 'q':
+		return sess.query(args)
+	case 'Q':
+		if args == "StartNoAckMode" {
+			err := sess.send("OK")
+			sess.mx.Lock()
+			sess.noAck = true
+			sess.mx.Unlock()
+			return err
+		}
+	}
+
+	// Unsupported packets get an empty reply
+	return sess.send("")
+}
+
+// Replies OK or with an error code
+func (sess *session) reply(err error) error {
+	if err != nil {
+		if sess.server.Log != nil {
+			fmt.Fprintf(sess.server.Log, "error: %v\n", err)
+		}
+		return sess.send("E01")
+	}
+	return sess.send("OK")
+}
+
+func (sess *session) query(args string) error {
+	name := args
+	if i := strings.IndexAny(args, ":,"); i >= 0 {
+		name = args[:i]
+	}
+
+	switch name {
+	case "Supported":
+		return sess.send("PacketSize=1000;QStartNoAckMode+;qXfer:features:read+;swbreak+;hwbreak+;ReverseStep+;ReverseContinue+")
+	case "Attached":
+		return sess.send("1")
+	case "C":
+		return sess.send("QC1")
+	case "fThreadInfo":
+		return sess.send("m1")
+	case "sThreadInfo":
+		return sess.send("l")
+	case "Xfer":
+		// qXfer:features:read:target.xml:offset,length
+		parts := strings.Split(args, ":")
+		if len(parts) != 5 || parts[1] != "features" || parts[2] != "read" || parts[3] != "target.xml" {
+			return sess.send("")
+		}
+		offset, length, err := parseRange(parts[4])
+		if err != nil {
+			return sess.send("E01")
+		}
+		return sess.send(xfer(targetXML(), int(offset), int(length)))
+	}
+
+	return sess.send("")
+}
+
+// Returns a chunk of a qXfer object, m if there is more and l if it is the last one
+func xfer(data string, offset, length int) string {
+	if offset >= len(data) {
+		return "l"
+	}
+	if offset+length >= len(data) {
+		return "l" + data[offset:]
+	}
+	return "m" + data[offset:offset+length]
+}
+
+// Describes the registers of the target
+func targetXML() string {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0"?><!DOCTYPE target SYSTEM "gdb-target.dtd">`)
+	b.WriteString(`<target version="1.0"><feature name="org.sic.core">`)
+	for i, r := range registers {
+		typ := "int"
+		switch r.name {
+		case "f":
+			typ = "uint64"
+		case "pc":
+			typ = "code_ptr"
+		}
+		fmt.Fprintf(&b, `<reg name="%s" bitsize="%d" regnum="%d" type="%s"/>`, r.name, r.size*8, i, typ)
+	}
+	b.WriteString(`</feature></target>`)
+	return b.String()
+}
+
+// Sets PC from the optional address of the s and c packets
+func (sess *session) resume(args string) error {
+	if args == "" {
+		return nil
+	}
+	addr, err := strconv.ParseUint(args, 16, 32)
+	if err != nil {
+		return err
+	}
+	sess.server.cpu.SetRegister(processor.RegPC, int32(addr))
+	return nil
+}
+
+// Runs the CPU until it stops or the client interrupts it
+func (sess *session) cont() error {
+	cpu := sess.server.cpu
+
+	// A stop nobody waited for must not end this run
+	select {
+	case <-sess.server.stops:
+	default:
+	}
+
+	cpu.Start()
+
+	for {
+		select {
+		case reason := <-sess.server.stops:
+			return sess.send(stopReply(reason))
+		case <-sess.interrupts:
+			cpu.Stop()
+		case err := <-sess.errs:
+			cpu.Stop()
+			return err
+		}
+	}
+}
+
+// Steps back (bs) or continues backwards (bc) through the journal of the CPU
+func (sess *session) reverse(args string) error {
+	cpu := sess.server.cpu
+
+	// Running out of the journal is reported as reaching the start of the replay log
+	if cpu.JournalLength() == 0 {
+		return sess.send(fmt.Sprintf("T%02xreplaylog:begin;", sigTrap))
+	}
+
+	switch args {
+	case "s":
+		if err := cpu.StepBack(); err != nil {
+			return sess.send("E01")
+		}
+		return sess.send(fmt.Sprintf("S%02x", sigTrap))
+	case "c":
+		reason, err := cpu.ReverseContinue()
+		if err != nil {
+			return sess.send("E01")
+		}
+		if reason.Kind == processor.StopPause {
+			return sess.send(fmt.Sprintf("T%02xreplaylog:begin;", sigTrap))
+		}
+		return sess.send(stopReply(reason))
+	}
+	return sess.send("")
+}
+
+func (sess *session) stepReply(err error) string {
+	if fault, ok := err.(*processor.Fault); ok {
+		return faultReply(fault)
+	}
+	return fmt.Sprintf("S%02x", sigTrap)
+}
+
+func faultReply(fault *processor.Fault) string {
+	sig, ok := faultSignals[fault.Kind]
+	if !ok {
+		sig = sigTrap
+	}
+	return fmt.Sprintf("S%02x", sig)
+}
+
+func stopReply(reason *processor.StopReason) string {
+	switch reason.Kind {
+	case processor.StopPause:
+		return fmt.Sprintf("S%02x", sigInt)
+	case processor.StopFault:
+		return faultReply(reason.Fault)
+	}
+
+	switch reason.Breakpoint.Kind {
+	case processor.BreakExecute:
+		return fmt.Sprintf("T%02xswbreak:;", sigTrap)
+	case processor.BreakWrite:
+		return fmt.Sprintf("T%02xwatch:%x;", sigTrap, reason.Address)
+	case processor.BreakRead:
+		return fmt.Sprintf("T%02xrwatch:%x;", sigTrap, reason.Address)
+	case processor.BreakAccess:
+		return fmt.Sprintf("T%02xawatch:%x;", sigTrap, reason.Address)
+	}
+	return fmt.Sprintf("S%02x", sigTrap)
+}
+
+// Adds or removes a breakpoint given as type,addr,kind
+func (sess *session) breakpoint(add bool, args string) error {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 || len(parts[0]) != 1 {
+		return fmt.Errorf("Invalid breakpoint %q", args)
+	}
+
+	kind, ok := watchKinds[parts[0][0]]
+	if !ok {
+		return fmt.Errorf("Unknown breakpoint type %q", parts[0])
+	}
+
+	addr, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return err
+	}
+	size, err := strconv.ParseUint(parts[2], 16, 32)
+	if err != nil {
+		return err
+	}
+
+	w := watch{parts[0][0], int32(addr), int32(size)}
+	bps := sess.server.cpu.Breakpoints
+
+	if !add {
+		if id, ok := sess.watches[w]; ok {
+			bps.Remove(id)
+			delete(sess.watches, w)
+		}
+		return nil
+	}
+
+	if _, ok := sess.watches[w]; ok {
+		return nil
+	}
+	bp := &processor.Breakpoint{Kind: kind, Address: w.addr}
+	if kind != processor.BreakExecute {
+		bp.Length = w.size
+	}
+	sess.watches[w] = bps.Add(bp)
+	return nil
+}
+
+func (sess *session) clearBreakpoints() {
+	for w, id := range sess.watches {
+		sess.server.cpu.Breakpoints.Remove(id)
+		delete(sess.watches, w)
+	}
+}
+
+func (sess *session) readRegisters() string {
+	var b bytes.Buffer
+	for i := range registers {
+		b.WriteString(sess.readRegister(i))
+	}
+	return b.String()
+}
+
+func (sess *session) writeRegisters(data string) error {
+	for i, r := range registers {
+		if len(data) < r.size*2 {
+			return fmt.Errorf("Too few registers")
+		}
+		if err := sess.writeRegister(i, data[:r.size*2]); err != nil {
+			return err
+		}
+		data = data[r.size*2:]
+	}
+	return nil
+}
+
+func (sess *session) readRegister(n int) string {
+	cpu := sess.server.cpu
+	r := registers[n]
+
+	if r.reg == processor.RegF {
+		return fmt.Sprintf("%012x", cpu.GetFloatBits())
+	}
+	return fmt.Sprintf("%06x", uint32(cpu.GetRegister(r.reg))&0xFFFFFF)
+}
+
+func (sess *session) writeRegister(n int, data string) error {
+	cpu := sess.server.cpu
+	r := registers[n]
+
+	if len(data) != r.size*2 {
+		return fmt.Errorf("Register %s has %d bytes", r.name, r.size)
+	}
+	value, err := strconv.ParseUint(data, 16, 64)
+	if err != nil {
+		return err
+	}
+
+	if r.reg == processor.RegF {
+		cpu.SetFloatBits(value)
+	} else {
+		cpu.SetRegister(r.reg, int32(value))
+	}
+	return nil
+}
+
+// The debugger bypasses storage keys and watchpoints
+func (sess *session) readMemory(addr, length int32) string {
+	if !inRange(addr, length) {
+		return "E01"
+	}
+	return hex.EncodeToString(sess.server.ram.GetRaw()[addr : addr+length])
+}
+
+func (sess *session) writeMemory(addr, length int32, data string) error {
+	if !inRange(addr, length) {
+		return fmt.Errorf("Address %#x out of range", addr+length)
+	}
+
+	values, err := hex.DecodeString(data)
+	if err != nil {
+		return err
+	}
+	if int32(len(values)) != length {
+		return fmt.Errorf("Expected %d bytes, got %d", length, len(values))
+	}
+
+	copy(sess.server.ram.GetRaw()[addr:], values)
+	return nil
+}
+
+func inRange(addr, length int32) bool {
+	return addr >= 0 && length >= 0 && int64(addr)+int64(length) <= memory.MaxAddress
+}
+
+// Parses addr,length
+func parseRange(args string) (addr, length int32, err error) {
+	parts := strings.Split(args, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Invalid range %q", args)
+	}
+
+	a, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	l, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int32(a), int32(l), nil
+}
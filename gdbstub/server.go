@@ -0,0 +1,236 @@
+// Package gdbstub serves the GDB remote serial protocol for a SIC/XE CPU, so
+// the machine can be driven by GDB and other debugger front-ends.
+package gdbstub
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Byte a client sends to interrupt a running target
+const interruptByte = 0x03
+
+// Server serves debugging sessions, one at a time
+type Server struct {
+	cpu *processor.CPU
+	ram *memory.RAM
+
+	// Stop reasons of the CPU while a session waits for it
+	stops chan *processor.StopReason
+
+	// Log receives every packet sent and received when not nil
+	Log io.Writer
+}
+
+// New creates a server for the CPU and its memory
+func New(cpu *processor.CPU, ram *memory.RAM) *Server {
+	s := &Server{
+		cpu:   cpu,
+		ram:   ram,
+		stops: make(chan *processor.StopReason, 1),
+	}
+
+	cpu.OnStop = append(cpu.OnStop, func(reason *processor.StopReason) {
+		// Called with the CPU locked, the reason is dropped when nobody waits for it
+		select {
+		case s.stops <- reason:
+		default:
+		}
+	})
+
+	return s
+}
+
+// Listen listens on addr, which is either tcp:host:port or unix:path. A TCP
+// address without a host listens on localhost only.
+func Listen(addr string) (net.Listener, error) {
+	return dev.Listen(addr)
+}
+
+// Serve accepts connections on l and serves them one after another until l is
+// closed or a client kills the target
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		killed, err := s.ServeConn(conn)
+		conn.Close()
+		if killed {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+	}
+}
+
+// ServeConn serves a single session over conn. It reports whether the client
+// killed the target.
+func (s *Server) ServeConn(conn io.ReadWriter) (killed bool, err error) {
+	sess := &session{
+		server:     s,
+		w:          bufio.NewWriter(conn),
+		packets:    make(chan string),
+		interrupts: make(chan struct{}, 1),
+		errs:       make(chan error, 1),
+		done:       make(chan struct{}),
+		watches:    map[watch]int{},
+	}
+	defer close(sess.done)
+
+	go sess.read(bufio.NewReader(conn))
+
+	for {
+		select {
+		case err := <-sess.errs:
+			s.cpu.Stop()
+			return false, err
+		case <-sess.interrupts:
+			// The target is already stopped
+		case packet := <-sess.packets:
+			if err := sess.handle(packet); err != nil {
+				if err == errKilled {
+					return true, nil
+				}
+				if err == errDetached {
+					return false, nil
+				}
+				return false, err
+			}
+		}
+	}
+}
+
+var (
+	errKilled   = errors.New("Killed")
+	errDetached = errors.New("Detached")
+)
+
+// Watchpoint or breakpoint as GDB identifies it
+type watch struct {
+	kind byte
+	addr int32
+	size int32
+}
+
+type session struct {
+	server *Server
+
+	// Replies are written by the session and acknowledgements by the reader
+	mx    sync.Mutex
+	w     *bufio.Writer
+	noAck bool
+	last  string
+
+	packets    chan string
+	interrupts chan struct{}
+	errs       chan error
+	done       chan struct{}
+
+	// IDs of the CPU breakpoints set by the client
+	watches map[watch]int
+}
+
+// Reads packets and interrupts from the client and acknowledges them
+func (sess *session) read(r *bufio.Reader) {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			sess.errs <- err
+			return
+		}
+
+		switch c {
+		case interruptByte:
+			select {
+			case sess.interrupts <- struct{}{}:
+			default:
+			}
+		case '-':
+			// The client wants the last packet again
+			sess.resend()
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				sess.errs <- err
+				return
+			}
+			data = data[:len(data)-1]
+
+			var sum [2]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				sess.errs <- err
+				return
+			}
+
+			sess.mx.Lock()
+			noAck := sess.noAck
+			sess.mx.Unlock()
+
+			if !noAck {
+				if fmt.Sprintf("%02x", checksum(data)) != strings.ToLower(string(sum[:])) {
+					sess.ack('-')
+					continue
+				}
+				sess.ack('+')
+			}
+
+			select {
+			case sess.packets <- data:
+			case <-sess.done:
+				return
+			}
+		}
+		// Acknowledgements and anything outside of packets are ignored
+	}
+}
+
+func (sess *session) ack(c byte) {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	sess.w.WriteByte(c)
+	sess.w.Flush()
+}
+
+func (sess *session) send(data string) error {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	return sess.write(data)
+}
+
+func (sess *session) write(data string) error {
+	if sess.server.Log != nil {
+		fmt.Fprintf(sess.server.Log, "-> %s\n", data)
+	}
+	sess.last = data
+	fmt.Fprintf(sess.w, "$%s#%02x", data, checksum(data))
+	return sess.w.Flush()
+}
+
+func (sess *session) resend() {
+	sess.mx.Lock()
+	defer sess.mx.Unlock()
+	if sess.last != "" {
+		sess.write(sess.last)
+	}
+}
+
+func checksum(data string) byte {
+	var sum byte
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
@@ -0,0 +1,183 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// LDA #5, STA 0x0C and J 6
+var program = []byte{0x01, 0x00, 0x05, 0x0F, 0x20, 0x06, 0x3F, 0x2F, 0xFD}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Starts a session with a CPU running the program, the session reports
+// whether it was killed on the returned channel
+func newClient(t *testing.T) (*client, *processor.CPU, <-chan bool) {
+	ram := memory.New()
+	copy(ram.GetRaw(), program)
+	cpu := processor.NewCPU(ram, dev.New())
+	cpu.SetSpeed(0)
+
+	server, conn := net.Pipe()
+	killed := make(chan bool, 1)
+	go func() {
+		k, _ := New(cpu, ram).ServeConn(server)
+		server.Close()
+		killed <- k
+	}()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{t, conn, bufio.NewReader(conn)}, cpu, killed
+}
+
+func (c *client) write(packet string) {
+	c.t.Helper()
+	if _, err := fmt.Fprintf(c.conn, "$%s#%02x", packet, checksum(packet)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) expect(s string) {
+	c.t.Helper()
+	buf := make([]byte, len(s))
+	for i := range buf {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		buf[i] = b
+	}
+	if string(buf) != s {
+		c.t.Fatalf("received %q, want %q", buf, s)
+	}
+}
+
+// Sends the packet and returns the reply
+func (c *client) request(packet string) string {
+	c.t.Helper()
+	c.write(packet)
+	c.expect("+$")
+	data, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	data = data[:len(data)-1]
+	sum := make([]byte, 2)
+	if _, err := c.r.Read(sum); err != nil {
+		c.t.Fatal(err)
+	}
+	if string(sum) != fmt.Sprintf("%02x", checksum(data)) {
+		c.t.Fatalf("reply %q with checksum %s", data, sum)
+	}
+	c.conn.Write([]byte("+"))
+	return data
+}
+
+func TestRegistersAndMemory(t *testing.T) {
+	c, cpu, _ := newClient(t)
+
+	if reply := c.request("?"); reply != "S05" {
+		t.Errorf("? replied %q", reply)
+	}
+	// Nine registers, F has 6 bytes
+	if reply := c.request("g"); len(reply) != 2*(8*3+6) {
+		t.Errorf("g replied %q", reply)
+	}
+
+	if reply := c.request("P0=123456"); reply != "OK" {
+		t.Errorf("P replied %q", reply)
+	}
+	if reply := c.request("p0"); reply != "123456" || cpu.GetRegister(processor.RegA) != 0x123456 {
+		t.Errorf("p replied %q, A is %06X", reply, cpu.GetRegister(processor.RegA))
+	}
+	if reply := c.request("p9"); reply != "E01" {
+		t.Errorf("p of an unknown register replied %q", reply)
+	}
+
+	if reply := c.request("M20,3:abcdef"); reply != "OK" {
+		t.Errorf("M replied %q", reply)
+	}
+	if reply := c.request("m1f,5"); reply != "00abcdef00" {
+		t.Errorf("m replied %q", reply)
+	}
+	if reply := c.request(fmt.Sprintf("m%x,2", memory.MaxAddress-1)); reply != "E01" {
+		t.Errorf("m outside of the memory replied %q", reply)
+	}
+
+	if reply := c.request("qXfer:features:read:target.xml:0,20"); !strings.HasPrefix(reply, "m<?xml") {
+		t.Errorf("qXfer replied %q", reply)
+	}
+	if reply := c.request("vMustReplyEmpty"); reply != "" {
+		t.Errorf("unsupported packet replied %q", reply)
+	}
+}
+
+func TestRun(t *testing.T) {
+	c, cpu, killed := newClient(t)
+
+	if reply := c.request("s"); reply != "S05" || cpu.GetRegister(processor.RegPC) != 3 {
+		t.Errorf("s replied %q, PC is %06X", reply, cpu.GetRegister(processor.RegPC))
+	}
+
+	// STA writes to 0x0C..0x0E
+	if reply := c.request("Z2,d,1"); reply != "OK" {
+		t.Errorf("Z2 replied %q", reply)
+	}
+	if reply := c.request("c"); reply != "T05watch:d;" {
+		t.Errorf("c replied %q, want a watchpoint stop", reply)
+	}
+	if reply := c.request("z2,d,1"); reply != "OK" {
+		t.Errorf("z2 replied %q", reply)
+	}
+
+	if reply := c.request("Z0,6,3"); reply != "OK" {
+		t.Errorf("Z0 replied %q", reply)
+	}
+	if reply := c.request("c0"); reply != "T05swbreak:;" || cpu.GetRegister(processor.RegPC) != 6 {
+		t.Errorf("c from 0 replied %q, PC is %06X", reply, cpu.GetRegister(processor.RegPC))
+	}
+	if a := cpu.GetRegister(processor.RegA); a != 5 {
+		t.Errorf("A is %d, want 5", a)
+	}
+
+	// An interrupt stops the endless loop
+	c.request("z0,6,3")
+	c.write("c")
+	c.expect("+")
+	time.Sleep(10 * time.Millisecond)
+	c.conn.Write([]byte{interruptByte})
+	c.expect("$S02#b5")
+	c.conn.Write([]byte("+"))
+
+	c.write("k")
+	c.expect("+")
+	if !<-killed {
+		t.Error("session was not killed")
+	}
+	if len(cpu.Breakpoints.List()) != 0 {
+		t.Errorf("breakpoints left after the session: %v", cpu.Breakpoints.List())
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	c, _, _ := newClient(t)
+
+	// A packet with a wrong checksum is rejected and sent again
+	fmt.Fprintf(c.conn, "$?#00")
+	c.expect("-")
+	if reply := c.request("?"); reply != "S05" {
+		t.Errorf("? replied %q", reply)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Exit statuses of a headless run that did not halt normally. A guest program
+// can exit with the same statuses, only the message on stderr tells them apart.
+const (
+	exitLimit = 124 // --max-steps or --timeout was reached
+	exitFault = 125 // the guest program faulted
+)
+
+// How long a run that reached its timeout may take to stop, before the wait
+// of an instruction for a device is cancelled
+const timeoutGrace = 100 * time.Millisecond
+
+var errTimeout = errors.New("Timeout reached")
+
+// Runs the program without the UI and the clock until it halts. A program
+// halts when it reaches haltAddr or jumps to itself (J *). The exit status
+// is the lowest byte of register A.
+func runHeadless(CPU *processor.CPU, devices *dev.DeviceManager, haltAddr int32, maxSteps int64, timeout time.Duration) int {
+	var expired int32
+	if timeout > 0 {
+		finished := make(chan struct{})
+		defer close(finished)
+
+		go func() {
+			select {
+			case <-finished:
+				return
+			case <-time.After(timeout):
+				atomic.StoreInt32(&expired, 1)
+			}
+
+			// An instruction such as RD can block on its device forever, its
+			// read fails so that the run ends like any other
+			select {
+			case <-finished:
+				return
+			case <-time.After(timeoutGrace):
+				devices.Cancel(errTimeout)
+			}
+
+			// A write cannot be cancelled, only ending the machine stops it
+			select {
+			case <-finished:
+			case <-time.After(timeoutGrace):
+				fmt.Fprintf(os.Stderr, "Timeout of %s reached while writing to a device\n", timeout)
+				os.Exit(exitLimit)
+			}
+		}()
+	}
+
+	for steps := int64(0); ; steps++ {
+		pc := CPU.GetRegister(processor.RegPC)
+		if pc == haltAddr {
+			break
+		}
+
+		if maxSteps > 0 && steps >= maxSteps {
+			fmt.Fprintf(os.Stderr, "Step limit of %d reached at %#06x\n", maxSteps, pc)
+			return exitLimit
+		}
+
+		if atomic.LoadInt32(&expired) != 0 {
+			fmt.Fprintf(os.Stderr, "Timeout of %s reached at %#06x\n", timeout, pc)
+			return exitLimit
+		}
+
+		if err := CPU.Exec(); err != nil {
+			if atomic.LoadInt32(&expired) != 0 {
+				fmt.Fprintf(os.Stderr, "Timeout of %s reached while waiting for a device at %#06x\n", timeout, pc)
+				return exitLimit
+			}
+			fmt.Fprintf(os.Stderr, "Fault: %v\n", err)
+			return exitFault
+		}
+
+		if CPU.GetRegister(processor.RegPC) == pc && !CPU.IsIdle() {
+			// J *
+			break
+		}
+	}
+
+	return int(CPU.GetRegister(processor.RegA) & 0xFF)
+}
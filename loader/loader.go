@@ -0,0 +1,125 @@
+// Package loader is a linking loader. It loads control sections one after
+// another and resolves the external symbols they define with D records and
+// refer to with R and M records.
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+)
+
+// SymbolError is an external symbol that is defined twice or not at all
+type SymbolError struct {
+	Symbol string
+	// Section that defines the symbol again or refers to the undefined one
+	Section   string
+	Duplicate bool
+}
+
+func (e *SymbolError) Error() string {
+	if e.Duplicate {
+		return fmt.Sprintf("Duplicate symbol %s in section %s", e.Symbol, e.Section)
+	}
+	return fmt.Sprintf("Undefined symbol %s in section %s", e.Symbol, e.Section)
+}
+
+// Errors are all the symbol errors found while linking
+type Errors []*SymbolError
+
+func (e Errors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Symbols returns the external symbol table of the sections loaded one after
+// another from base. The name of every section is a symbol at its address.
+func Symbols(sections []*obj.ObjectCode, base int32) (map[string]int32, error) {
+	var errs Errors
+	symbols := map[string]int32{}
+
+	define := func(name string, addr int32, section string) {
+		if _, ok := symbols[name]; ok {
+			errs = append(errs, &SymbolError{Symbol: name, Section: section, Duplicate: true})
+			return
+		}
+		symbols[name] = addr
+	}
+
+	addr := base
+	for _, cs := range sections {
+		name := strings.TrimSpace(cs.Name)
+		define(name, addr, name)
+		for _, def := range cs.Definitions {
+			define(def.Name, addr+def.Addr, name)
+		}
+		addr += cs.Length
+	}
+
+	if errs != nil {
+		return nil, errs
+	}
+	return symbols, nil
+}
+
+// Load links the sections, loads them one after another from base and returns
+// the start address. It is the address in the first E record that has one, or
+// base if none does.
+func Load(ram *memory.RAM, sections []*obj.ObjectCode, base int32) (start int32, err error) {
+	symbols, err := Symbols(sections, base)
+	if err != nil {
+		return 0, err
+	}
+
+	var errs Errors
+	for _, cs := range sections {
+		name := strings.TrimSpace(cs.Name)
+		reported := map[string]bool{}
+		undefined := func(symbol string) {
+			if _, ok := symbols[symbol]; !ok && !reported[symbol] {
+				errs = append(errs, &SymbolError{Symbol: symbol, Section: name})
+				reported[symbol] = true
+			}
+		}
+
+		for _, ref := range cs.References {
+			undefined(ref)
+		}
+		for _, mod := range cs.Modifications {
+			if mod.Symbol != "" {
+				undefined(mod.Symbol)
+			}
+		}
+	}
+	if errs != nil {
+		return 0, errs
+	}
+
+	// Sections that do not fit are reported instead of crashing the machine
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*memory.AddressError)
+			if !ok {
+				panic(r)
+			}
+			start, err = 0, fmt.Errorf("Program does not fit in the memory: %v", e)
+		}
+	}()
+
+	start = base
+	found := false
+	addr := base
+	for _, cs := range sections {
+		entry := ram.LoadAt(cs, addr, symbols)
+		if cs.HasStart && !found {
+			start, found = entry, true
+		}
+		addr += cs.Length
+	}
+	return start, nil
+}
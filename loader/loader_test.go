@@ -0,0 +1,112 @@
+package loader
+
+import (
+	"strings"
+	"testing"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// MAIN calls SUB, which adds the value of MAINV to 41
+const mainObj = `HMAIN  00000000000A
+DMAINV 000007
+RSUB
+T0000000A4B1000003F2FFD000001
+M00000105+SUB
+E000000
+`
+
+const subObj = `HSUB   00000000000E
+RMAINV
+T0000000E0310000B1B1000004F0000000029
+M00000105+SUB
+M00000505+MAINV
+E
+`
+
+func parse(t *testing.T, objects ...string) []*obj.ObjectCode {
+	t.Helper()
+	var sections []*obj.ObjectCode
+	for _, o := range objects {
+		cs, err := obj.Parse(strings.NewReader(o), "test.obj")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sections = append(sections, cs...)
+	}
+	return sections
+}
+
+func TestSymbols(t *testing.T) {
+	symbols, err := Symbols(parse(t, mainObj, subObj), 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int32{"MAIN": 0x1000, "MAINV": 0x1007, "SUB": 0x100A}
+	if len(symbols) != len(want) {
+		t.Errorf("symbols %v, want %v", symbols, want)
+	}
+	for name, addr := range want {
+		if symbols[name] != addr {
+			t.Errorf("%s at %06X, want %06X", name, symbols[name], addr)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	ram := memory.New()
+	start, err := Load(ram, parse(t, mainObj, subObj), 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 0x1000 {
+		t.Errorf("start %06X, want 001000", start)
+	}
+
+	// Addresses of format 4 instructions are modified in their last 20 bits
+	fields := []struct {
+		addr, value int32
+	}{
+		{0x1001, 0x100A},
+		{0x100B, 0x1015},
+		{0x100F, 0x1007},
+	}
+	for _, f := range fields {
+		if v := ram.GetWord(f.addr) & 0xFFFFF; v != f.value {
+			t.Errorf("address at %06X is %05X, want %05X", f.addr, v, f.value)
+		}
+	}
+
+	cpu := processor.NewCPU(ram, dev.New())
+	cpu.SetStart(start)
+	for i := 0; i < 4; i++ {
+		if err := cpu.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a, pc := cpu.GetRegister(processor.RegA), cpu.GetRegister(processor.RegPC); a != 42 || pc != 0x1004 {
+		t.Errorf("A %d and PC %06X after the call, want 42 and 001004", a, pc)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		objects []string
+		base    int32
+		err     string
+	}{
+		{[]string{subObj}, 0, "Undefined symbol MAINV in section SUB"},
+		{[]string{mainObj, mainObj, subObj}, 0, "Duplicate symbol MAIN in section MAIN\nDuplicate symbol MAINV in section MAIN"},
+		{[]string{mainObj, subObj}, memory.MaxAddress - 0x10, "Program does not fit in the memory: Invalid memory address 0xf000"},
+	}
+
+	for _, test := range tests {
+		_, err := Load(memory.New(), parse(t, test.objects...), test.base)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("error %v, want %s", err, test.err)
+		}
+	}
+}
@@ -1,82 +1,425 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/uroshercog/sic-machine/dap"
 	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/disasm"
+	"github.com/uroshercog/sic-machine/gdbstub"
+	"github.com/uroshercog/sic-machine/loader"
 	"github.com/uroshercog/sic-machine/memory"
 	"github.com/uroshercog/sic-machine/obj"
-	"bufio"
 	"github.com/uroshercog/sic-machine/processor"
+	"github.com/uroshercog/sic-machine/snapshot"
+	"github.com/uroshercog/sic-machine/trace"
 	"github.com/uroshercog/sic-machine/ui"
-	"fmt"
 )
 
+var (
+	headless  = flag.Bool("headless", false, "run without the UI, as fast as possible, and exit with the status in register A, 124 and 125 also mean a limit or a fault")
+	haltAddr  = flag.String("halt-addr", "", "address at which a headless run halts, besides J *")
+	loadAt    = flag.String("load-at", "", "relocate the program to the address instead of the one in its header, binary images are loaded at 0 otherwise")
+	entry     = flag.String("entry", "", "start at the address instead of the one in the object file")
+	format    = flag.String("format", "", "format of the object files: sic, bin, ihex or srec, detected by their content by default")
+	maxSteps  = flag.Int64("max-steps", 0, "maximum number of instructions of a headless run, 0 for no limit")
+	timeout   = flag.Duration("timeout", 0, "maximum duration of a headless run, 0 for no limit")
+	gdbAddr   = flag.String("gdb", "", "wait for a GDB remote protocol client on tcp:host:port or unix:path instead of running")
+	gdbLog    = flag.Bool("gdb-log", false, "log the GDB remote protocol packets to stderr")
+	saveState = flag.String("save-state", "", "save a snapshot of the machine to the file when a headless run ends or [w] is pressed")
+	loadState = flag.String("load-state", "", "resume the machine from a snapshot, the object file is then optional")
+	recordIn  = flag.String("record-input", "", "log every byte read from the devices into the file")
+	replayIn  = flag.String("replay-input", "", "read the devices from a log made with --record-input instead")
+	traceFile = flag.String("trace", "", "record every executed instruction into the file, see cmd/trace")
+	journal   = flag.Int("journal", 0, "number of executed instructions that can be stepped back, 0 turns reverse execution off")
+	dapMode   = flag.Bool("dap", false, "serve the Debug Adapter Protocol on stdin and stdout, the client launches the program")
+	devConfig = flag.String("device-config", "", "read the device map from the [devices] table of a TOML file")
+
+	breakpoints addressList
+	watchpoints addressList
+	deviceMap   mappingList
+)
+
+func init() {
+	flag.Var(&breakpoints, "break", "stop before the instruction at the address is executed, can be repeated")
+	flag.Var(&watchpoints, "watch", "stop after the word at the address is written to, can be repeated")
+	flag.Var(&deviceMap, "device", "map a device, e.g. 05=file:input.txt:ro, can be repeated (see devices.Mapping)")
+}
+
+// addressList is a flag that can be repeated, each value is an address
+type addressList []int32
+
+func (l *addressList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *addressList) Set(value string) error {
+	addr, err := strconv.ParseInt(value, 0, 32)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, int32(addr))
+	return nil
+}
+
+// mappingList is a flag that can be repeated, each value is a device mapping
+type mappingList []dev.Mapping
+
+func (l *mappingList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *mappingList) Set(value string) error {
+	m, err := dev.ParseMapping(value)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, m)
+	return nil
+}
+
 func main() {
 	defer func() {
 		if r := recover(); r != nil {
 			fmt.Fprintf(os.Stderr, "Exception: %v\n", r)
+			os.Exit(1)
 		}
 	}()
 
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <object file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *dapMode {
+		if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	/* 1. Preberi ime datoteke iz command line argumentov */
 
-	if len(os.Args) < 2 {
+	if flag.NArg() < 1 && *loadState == "" {
 		panic("No filename provided")
 	}
-	objectFileName := string(os.Args[1])
 
-	uix := &ui.UI{}
 	devices := dev.New()
+	mapDevices(devices)
 	RAM := memory.New()
-
 	CPU := processor.NewCPU(RAM, devices)
+
+	/*
+		2. Nalozi cel podan fajl v RAM
+			 - ime fajla je podano preko argumentov
+	*/
+	if flag.NArg() > 0 {
+		// Control sections of all the files are linked and loaded one after another
+		var sections []*obj.ObjectCode
+		for _, filename := range flag.Args() {
+			sections = append(sections, parseObjectCode(filename)...)
+		}
+		if len(sections) == 0 {
+			panic("No control sections in the object files")
+		}
+
+		base := sections[0].LoadAddr
+		if *loadAt != "" {
+			base = parseAddress(*loadAt)
+		}
+		start, err := loader.Load(RAM, sections, base)
+		if err != nil {
+			panic(err)
+		}
+		if *entry != "" {
+			start = parseAddress(*entry)
+		}
+		CPU.SetStart(start)
+	}
+
+	CPU.SetJournalSize(*journal)
+
+	// The snapshot overwrites the whole machine, including the loaded program
+	if *loadState != "" {
+		if err := snapshot.Load(*loadState, CPU, RAM, devices); err != nil {
+			panic(err)
+		}
+	}
+
+	for _, addr := range breakpoints {
+		CPU.Breakpoints.Add(&processor.Breakpoint{Kind: processor.BreakExecute, Address: addr})
+	}
+	for _, addr := range watchpoints {
+		CPU.Breakpoints.Add(&processor.Breakpoint{Kind: processor.BreakWrite, Address: addr, Length: 3})
+	}
+
+	finishInput := func() {}
+	if *recordIn != "" {
+		finishInput = recordInput(CPU, devices, *recordIn)
+	}
+	if *replayIn != "" {
+		replayInput(devices, *replayIn)
+	}
+	defer finishInput()
+
+	finishTrace := func() {}
+	if *traceFile != "" {
+		finishTrace = startTrace(CPU, RAM, *traceFile)
+	}
+	defer finishTrace()
+
+	if *gdbAddr != "" {
+		runGDB(CPU, RAM, *gdbAddr)
+		return
+	}
+
+	if *headless {
+		halt := int32(-1)
+		if *haltAddr != "" {
+			halt = parseAddress(*haltAddr)
+		}
+		status := runHeadless(CPU, devices, halt, *maxSteps, *timeout)
+		if *saveState != "" {
+			if err := snapshot.Save(*saveState, CPU, RAM, devices); err != nil {
+				fmt.Fprintf(os.Stderr, "Saving the state: %v\n", err)
+			}
+		}
+		finishTrace()
+		finishInput()
+		os.Exit(status)
+	}
+
+	runUI(CPU, RAM, devices)
+}
+
+// Maps the devices of the config file and then of the flags
+func mapDevices(devices *dev.DeviceManager) {
+	var mappings []dev.Mapping
+	if *devConfig != "" {
+		f, err := os.Open(*devConfig)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+
+		if mappings, err = dev.ReadConfig(f, *devConfig); err != nil {
+			panic(err)
+		}
+	}
+
+	if err := devices.Map(append(mappings, deviceMap...)); err != nil {
+		panic(err)
+	}
+}
+
+// Starts recording a trace, the returned function stops the CPU and finishes the trace
+func startTrace(CPU *processor.CPU, RAM *memory.RAM, filename string) func() {
+	f, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+
+	recorder, err := trace.NewRecorder(f, CPU, RAM)
+	if err != nil {
+		panic(err)
+	}
+
+	return func() {
+		CPU.Stop()
+		if err := recorder.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Writing the trace: %v\n", err)
+		}
+		f.Close()
+	}
+}
+
+// Starts logging the device input, the returned function stops the CPU and finishes the log
+func recordInput(CPU *processor.CPU, devices *dev.DeviceManager, filename string) func() {
+	f, err := os.Create(filename)
+	if err != nil {
+		panic(err)
+	}
+	if err := devices.Record(f); err != nil {
+		panic(err)
+	}
+
+	return func() {
+		CPU.Stop()
+		if err := devices.FinishRecording(); err != nil {
+			fmt.Fprintf(os.Stderr, "Writing the input log: %v\n", err)
+		}
+		f.Close()
+	}
+}
+
+// The log stays open until the machine exits
+func replayInput(devices *dev.DeviceManager, filename string) {
+	f, err := os.Open(filename)
+	if err != nil {
+		panic(err)
+	}
+	if err := devices.Replay(f); err != nil {
+		panic(fmt.Errorf("%s: %v", filename, err))
+	}
+}
+
+// Serves GDB clients until one of them kills the target
+func runGDB(CPU *processor.CPU, RAM *memory.RAM, addr string) {
+	l, err := gdbstub.Listen(addr)
+	if err != nil {
+		panic(err)
+	}
+	defer l.Close()
+
+	// Continue runs flat out, a client interrupts it with Ctrl-C
+	CPU.SetSpeed(0)
+
+	server := gdbstub.New(CPU, RAM)
+	if *gdbLog {
+		server.Log = os.Stderr
+	}
+
+	fmt.Fprintf(os.Stderr, "Waiting for GDB on %s\n", l.Addr())
+	if err := server.Serve(l); err != nil {
+		panic(err)
+	}
+}
+
+func runUI(CPU *processor.CPU, RAM *memory.RAM, devices *dev.DeviceManager) {
+	uix := &ui.UI{}
+
+	// The terminal belongs to the UI, so the guest reads the keys typed into the console instead of stdin
+	for _, keyboard := range devices.ReplaceStdin() {
+		uix.OnType = append(uix.OnType, keyboard.Type)
+	}
+
 	CPU.OnStart = append(CPU.OnStart, func() {
 		uix.RenderStatusWidget("started")
 		uix.RenderRegistersWidget(CPU.GetRegisters())
 	})
 
-	CPU.OnStop = append(CPU.OnStop, func() {
-		uix.RenderStatusWidget("stopped")
+	CPU.OnStop = append(CPU.OnStop, func(reason *processor.StopReason) {
+		uix.RenderStatusWidget(reason.String())
 	})
 
-	CPU.OnExec = append(CPU.OnExec, func(cmd string) {
-		uix.RenderExecutingCommand(cmd)
+	CPU.OnExec = append(CPU.OnExec, func(inst *disasm.Instruction) {
+		uix.RenderExecutingCommand(inst)
 		uix.RenderRegistersWidget(CPU.GetRegisters())
 		uix.RenderRAMWidget(RAM.GetRaw())
 		uix.RenderScreenWidget(RAM.GetRaw())
 	})
 
+	CPU.OnFault = append(CPU.OnFault, func(fault *processor.Fault) {
+		address := "-"
+		if fault.Address >= 0 {
+			address = fmt.Sprintf("%#06x", fault.Address)
+		}
+
+		uix.RenderStatusWidget("faulted")
+		uix.RenderRegistersWidget(CPU.GetRegisters())
+		uix.RenderFaultWidget([]string{
+			fault.Kind.String(),
+			fmt.Sprintf("PC %#06x [% x]", fault.PC, fault.Instruction),
+			"Address " + address,
+			fmt.Sprint(fault.Err),
+		})
+	})
+
 	uix.Handle(ui.PAUSE, CPU.Stop)
 	uix.Handle(ui.CONTINUE, CPU.Start)
 	uix.Handle(ui.STEP, CPU.Step)
 
-	/*
-		2. Nalozi cel podan fajl v RAM
-			 - ime fajla je podano preko argumentov
-	*/
-	objectCode := parseObjectCode(objectFileName)
-	RAM.Load(objectCode)
-	CPU.SetStart(objectCode.StartAddr)
+	uix.Handle(ui.BACK, func() {
+		if err := CPU.StepBack(); err != nil {
+			uix.RenderStatusWidget(err.Error())
+			return
+		}
+		uix.RenderStatusWidget("stepped back")
+		uix.RenderExecutingCommand(nil)
+		uix.RenderRegistersWidget(CPU.GetRegisters())
+		uix.RenderRAMWidget(RAM.GetRaw())
+		uix.RenderScreenWidget(RAM.GetRaw())
+	})
+
+	uix.Handle(ui.REVERSE, func() {
+		reason, err := CPU.ReverseContinue()
+		if err != nil {
+			uix.RenderStatusWidget(err.Error())
+			return
+		}
+		uix.RenderStatusWidget("reversed to " + reason.String())
+		uix.RenderExecutingCommand(nil)
+		uix.RenderRegistersWidget(CPU.GetRegisters())
+		uix.RenderRAMWidget(RAM.GetRaw())
+		uix.RenderScreenWidget(RAM.GetRaw())
+	})
+
+	uix.Handle(ui.SAVE, func() {
+		filename := *saveState
+		if filename == "" {
+			filename = "machine.snap"
+		}
+
+		// The snapshot is taken between two instructions
+		running := CPU.IsRunning()
+		CPU.Stop()
+		if err := snapshot.Save(filename, CPU, RAM, devices); err != nil {
+			uix.RenderStatusWidget("save failed: " + err.Error())
+		} else {
+			uix.RenderStatusWidget("saved to " + filename)
+		}
+		if running {
+			CPU.Start()
+		}
+	})
+
+	uix.Handle(ui.LOAD, func() {
+		filename := *loadState
+		if filename == "" {
+			filename = *saveState
+		}
+		if filename == "" {
+			filename = "machine.snap"
+		}
+
+		CPU.Stop()
+		if err := snapshot.Load(filename, CPU, RAM, devices); err != nil {
+			uix.RenderStatusWidget("load failed: " + err.Error())
+			return
+		}
+		uix.RenderStatusWidget("loaded " + filename)
+		uix.RenderRegistersWidget(CPU.GetRegisters())
+		uix.RenderRAMWidget(RAM.GetRaw())
+		uix.RenderScreenWidget(RAM.GetRaw())
+	})
+
 	uix.Run(RAM.GetRaw(), CPU.GetRegisters())
 }
 
-func parseObjectCode(filename string) *obj.ObjectCode {
-	objCode := &obj.ObjectCode{}
+// Parses a decimal, 0x hexadecimal or 0 octal address
+func parseAddress(s string) int32 {
+	addr, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		panic(err)
+	}
+	return int32(addr)
+}
 
-	if f, err := os.Open(filename); err != nil {
+// Parses the control sections of an object file in the --format, every problem of the file is reported
+func parseObjectCode(filename string) []*obj.ObjectCode {
+	f, err := os.Open(filename)
+	if err != nil {
 		panic(err)
-	} else {
-		// Lets assume that no line can be more than 4096 bytes long
-		reader := bufio.NewReader(f)
-		for {
-			if line, _, err := reader.ReadLine(); err == nil {
-				objCode.Load(line)
-			} else {
-				break
-			}
-		}
 	}
+	defer f.Close()
 
-	return objCode
+	sections, err := obj.Read(f, filename, obj.Format(*format))
+	if err != nil {
+		panic(err)
+	}
+	return sections
 }
@@ -4,29 +4,70 @@ import (
 	//"fmt"
 	"github.com/uroshercog/sic-machine/obj"
 	"fmt"
+	"strings"
 )
 
 // MaxAddress ...
 const MaxAddress = 0xF000 // bytes
 
+// BlockSize is the number of bytes protected by a single storage key
+const BlockSize = 0x800 // bytes
+
 const (
 	errInvalidMemoryAddress = "Invalid memory address"
+	errProtectionViolation  = "Memory protection violation"
 )
 
+// AddressError is the panic value of an access outside of the memory
+type AddressError struct {
+	Addr int32
+}
+
+func (e *AddressError) Error() string {
+	return fmt.Sprintf("%s %#x", errInvalidMemoryAddress, e.Addr)
+}
+
+// ProtectionError is the panic value of an access to a block whose
+// storage key does not match the key of the running process
+type ProtectionError struct {
+	Addr  int32
+	Write bool
+}
+
+func (e *ProtectionError) Error() string {
+	return fmt.Sprintf("%s %#x", errProtectionViolation, e.Addr)
+}
+
 // RAM ...
 type RAM struct {
 	cells []byte
+	keys  []byte
+	// Access is unrestricted in supervisor mode, otherwise only blocks with a matching key can be accessed
+	supervisor bool
+	key        byte
+	// Called for every byte read or written with GetByte and SetByte, before the access.
+	// OnWrite is also called for the bytes written by the channels.
+	OnRead  []func(addr int32)
+	OnWrite []func(addr int32, value byte)
 }
 
 // GetByte ...
 func (ram *RAM) GetByte(addr int32) (byte) {
 	ram.ValidAddress(addr)
+	ram.checkAccess(addr, false)
+	for _, f := range ram.OnRead {
+		f(addr)
+	}
 	return ram.cells[addr]
 }
 
 // SetByte ...
 func (ram *RAM) SetByte(addr int32, value byte) (err error) {
 	ram.ValidAddress(addr)
+	ram.checkAccess(addr, true)
+	for _, f := range ram.OnWrite {
+		f(addr, value)
+	}
 	ram.cells[addr] = value
 	return
 }
@@ -41,39 +82,154 @@ func (ram *RAM) GetWord(addr int32) (ret int32) {
 	ret = (ret << 8) + int32(val)
 	val = ram.GetByte(addr + 2)
 	ret = (ret << 8) + int32(val)
+
+	// Words are signed
+	if ret&0x800000 != 0 {
+		ret -= 0x1000000
+	}
 	return
 }
 
 // SetWord ...
 func (ram *RAM) SetWord(addr int32, value int32) {
 	ram.ValidAddress(addr + 2)
+	ram.checkAccess(addr, true)
+	ram.checkAccess(addr+2, true)
 	ram.SetByte(addr, byte((value & 0xFF0000) >> 16))
 	ram.SetByte(addr+1, byte((value & 0xFF00) >> 8))
 	ram.SetByte(addr+2, byte(value & 0xFF))
 }
 
-// Load ...
+// GetFloat returns the raw 48-bit floating point value at addr..addr+5
+func (ram *RAM) GetFloat(addr int32) (ret uint64) {
+	ram.ValidAddress(addr + 5)
+
+	for i := int32(0); i < 6; i++ {
+		ret = (ret << 8) | uint64(ram.GetByte(addr+i))
+	}
+	return
+}
+
+// SetFloat stores the raw 48-bit floating point value to addr..addr+5
+func (ram *RAM) SetFloat(addr int32, value uint64) {
+	ram.ValidAddress(addr + 5)
+	ram.checkAccess(addr, true)
+	ram.checkAccess(addr+5, true)
+
+	for i := int32(0); i < 6; i++ {
+		ram.SetByte(addr+i, byte(value>>uint(8*(5-i))))
+	}
+}
+
+// Load loads the program at the address in its header
 func (ram *RAM) Load(objCode *obj.ObjectCode) {
+	ram.LoadAt(objCode, objCode.LoadAddr, nil)
+}
+
+// LoadAt loads the program at base, relocating it with its M records, and
+// returns the relocated start address. M records are relative to the start
+// of the program. Those with the name of the program or without a symbol
+// relocate by the difference to the address in the header, other symbols add
+// their address from symbols.
+func (ram *RAM) LoadAt(objCode *obj.ObjectCode, base int32, symbols map[string]int32) int32 {
+	delta := base - objCode.LoadAddr
+
 	for _, body := range objCode.Code {
 		for i, code := range body.Code {
-			addr := body.StartAddr + int32(i)
+			addr := body.StartAddr + delta + int32(i)
 			ram.ValidAddress(addr)
 			ram.cells[addr] = code
 		}
 	}
+
+	name := strings.TrimSpace(objCode.Name)
+	for _, mod := range objCode.Modifications {
+		value := delta
+		if mod.Symbol != "" && mod.Symbol != name {
+			var ok bool
+			if value, ok = symbols[mod.Symbol]; !ok {
+				panic(fmt.Errorf("Undefined symbol %s in M record at %06X", mod.Symbol, mod.Addr))
+			}
+		}
+		if mod.Sign == '-' {
+			value = -value
+		}
+		ram.Modify(base+mod.Addr, mod.Length, value)
+	}
+
+	return objCode.StartAddr + delta
+}
+
+// Modify adds value to the field of length half-bytes at addr, the field
+// ends at the last of its bytes and the rest of the bytes are kept
+func (ram *RAM) Modify(addr int32, length int32, value int32) {
+	size := (length + 1) / 2
+	ram.ValidAddress(addr)
+	ram.ValidAddress(addr + size - 1)
+
+	var word uint32
+	for i := int32(0); i < size; i++ {
+		word = word<<8 | uint32(ram.cells[addr+i])
+	}
+
+	mask := uint32(1)<<uint(4*length) - 1
+	word = word&^mask | (word+uint32(value))&mask
+
+	for i := size - 1; i >= 0; i-- {
+		ram.cells[addr+i] = byte(word)
+		word >>= 8
+	}
 }
 
 func (ram *RAM) ValidAddress(addr int32) {
 	if addr < 0 || addr >= MaxAddress {
-		panic(fmt.Errorf(fmt.Sprintf("%s %s", errInvalidMemoryAddress, "%#x"), addr))
+		panic(&AddressError{addr})
 	}
 }
 
+// SetAccess sets the mode and the key of the running process, which are used to check every access
+func (ram *RAM) SetAccess(supervisor bool, key byte) {
+	ram.supervisor = supervisor
+	ram.key = key
+}
+
+// SetKey sets the storage key of the block containing addr
+func (ram *RAM) SetKey(addr int32, key byte) {
+	ram.ValidAddress(addr)
+	ram.keys[addr/BlockSize] = key
+}
+
+// GetKey returns the storage key of the block containing addr
+func (ram *RAM) GetKey(addr int32) byte {
+	ram.ValidAddress(addr)
+	return ram.keys[addr/BlockSize]
+}
+
+func (ram *RAM) checkAccess(addr int32, write bool) {
+	if !ram.supervisor && ram.keys[addr/BlockSize] != ram.key {
+		panic(&ProtectionError{addr, write})
+	}
+}
+
+// StoreByte writes a byte without the protection check, for the channels that
+// access the memory directly. OnWrite is called like for SetByte.
+func (ram *RAM) StoreByte(addr int32, value byte) {
+	ram.ValidAddress(addr)
+	for _, f := range ram.OnWrite {
+		f(addr, value)
+	}
+	ram.cells[addr] = value
+}
+
 func (ram *RAM) GetRaw() []byte {
 	return ram.cells
 }
 
 // New ...
 func New() *RAM {
-	return &RAM{make([]byte, MaxAddress)}
+	return &RAM{
+		cells:      make([]byte, MaxAddress),
+		keys:       make([]byte, MaxAddress/BlockSize),
+		supervisor: true,
+	}
 }
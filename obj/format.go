@@ -0,0 +1,88 @@
+package obj
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Format of a file with a program
+type Format string
+
+const (
+	// FormatAuto detects the format by the content of the file
+	FormatAuto Format = ""
+	// FormatSIC is the text of H, T, M, D, R and E records
+	FormatSIC Format = "sic"
+	// FormatBinary is a raw memory image, loaded at 0 unless relocated
+	FormatBinary Format = "bin"
+	// FormatIHex is Intel HEX
+	FormatIHex Format = "ihex"
+	// FormatSRec is Motorola S-records
+	FormatSRec Format = "srec"
+)
+
+// Detect returns the format of the file content. Files that are not text are
+// binary images, text is SIC object code unless its first record is an Intel
+// HEX or S-record one.
+func Detect(data []byte) Format {
+	for _, b := range data {
+		if b >= 0x7F || b < ' ' && b != '\n' && b != '\r' && b != '\t' {
+			return FormatBinary
+		}
+	}
+
+	text := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case len(text) > 0 && text[0] == ':':
+		return FormatIHex
+	case len(text) > 1 && text[0] == 'S' && text[1] >= '0' && text[1] <= '9':
+		return FormatSRec
+	}
+	return FormatSIC
+}
+
+// Read reads the control sections of a file in the format, FormatAuto detects
+// it. Like with Parse all problems are returned as an ErrorList.
+func Read(r io.Reader, filename string, format Format) ([]*ObjectCode, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == FormatAuto {
+		format = Detect(data)
+	}
+
+	switch format {
+	case FormatSIC:
+		return Parse(bytes.NewReader(data), filename)
+	case FormatBinary:
+		return parseBinary(data, filename)
+	case FormatIHex:
+		return parseHexRecords(data, filename, ihexRecord)
+	case FormatSRec:
+		return parseHexRecords(data, filename, srecRecord)
+	}
+	return nil, fmt.Errorf("Unknown format %q, expected sic, bin, ihex or srec", format)
+}
+
+// Name of the only control section of a file in the other formats
+func sectionName(filename string) string {
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	name = strings.ToUpper(name)
+	if len(name) > 6 {
+		name = name[:6]
+	}
+	return name
+}
+
+func parseBinary(data []byte, filename string) ([]*ObjectCode, error) {
+	if len(data) == 0 {
+		return nil, ErrorList{{filename, 0, "Empty image"}}
+	}
+	return []*ObjectCode{FromImage(sectionName(filename), 0, data, 0)}, nil
+}
@@ -0,0 +1,164 @@
+package obj
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Intel HEX record with its checksum
+func ihex(kind byte, addr int, data ...byte) string {
+	record := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), kind}, data...)
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	return fmt.Sprintf(":%X%02X", record, -sum)
+}
+
+// S-record with its checksum, the address has addrLength bytes
+func srec(kind byte, addrLength int, addr int, data ...byte) string {
+	record := []byte{byte(addrLength + len(data) + 1)}
+	for i := addrLength - 1; i >= 0; i-- {
+		record = append(record, byte(addr>>uint(8*i)))
+	}
+	record = append(record, data...)
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	return fmt.Sprintf("S%c%X%02X", kind, record, ^sum)
+}
+
+func lines(records ...string) string {
+	return strings.Join(records, "\n") + "\n"
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		data string
+		want Format
+	}{
+		{"HPROG  000000000003\n", FormatSIC},
+		{"", FormatSIC},
+		{"\n:00000001FF\n", FormatIHex},
+		{"S9030000FC\n", FormatSRec},
+		{"SUB\n", FormatSIC},
+		{"\x01\x02\x03", FormatBinary},
+		{"H\x00", FormatBinary},
+	}
+
+	for _, test := range tests {
+		if got := Detect([]byte(test.data)); got != test.want {
+			t.Errorf("Detect(%q) = %q, want %q", test.data, got, test.want)
+		}
+	}
+}
+
+func TestReadFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		// Expected section
+		load, length, start int32
+		cells               map[int32]byte
+	}{
+		{"binary", FormatBinary, "\x01\x02\x03", 0, 3, 0, map[int32]byte{0: 1, 1: 2, 2: 3}},
+		{"ihex", FormatAuto, lines(
+			ihex(0x00, 0x100, 1, 2),
+			ihex(0x00, 0x110, 3),
+			ihex(0x05, 0, 0, 0, 0x01, 0x10),
+			ihex(0x01, 0),
+		), 0x100, 0x11, 0x110, map[int32]byte{0x100: 1, 0x101: 2, 0x110: 3}},
+		{"ihex extended addresses", FormatIHex, lines(
+			ihex(0x04, 0, 0x00, 0x01),
+			ihex(0x00, 0x0002, 7),
+			ihex(0x02, 0, 0x10, 0x00),
+			ihex(0x00, 0x0003, 8),
+			ihex(0x03, 0, 0x10, 0x00, 0x00, 0x03),
+			ihex(0x01, 0),
+		), 0x10002, 2, 0x10003, map[int32]byte{0x10002: 7, 0x10003: 8}},
+		{"srec", FormatAuto, lines(
+			srec('0', 2, 0, 'T', 'E', 'S', 'T'),
+			srec('1', 2, 0x200, 1, 2),
+			srec('2', 3, 0x10000, 3),
+			srec('5', 2, 2),
+			srec('9', 2, 0x201),
+		), 0x200, 0xFE01, 0x201, map[int32]byte{0x200: 1, 0x201: 2, 0x10000: 3}},
+	}
+
+	for _, test := range tests {
+		sections, err := Read(strings.NewReader(test.data), "prog.x", test.format)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := sections[0]
+		if got.LoadAddr != test.load || got.Length != test.length || got.StartAddr != test.start {
+			t.Errorf("%s: load %06X, length %06X and start %06X, want %06X, %06X and %06X", test.name,
+				got.LoadAddr, got.Length, got.StartAddr, test.load, test.length, test.start)
+		}
+		if !reflect.DeepEqual(image(got), test.cells) {
+			t.Errorf("%s: text %v, want %v", test.name, image(got), test.cells)
+		}
+	}
+}
+
+func TestReadSectionName(t *testing.T) {
+	sections, err := Read(strings.NewReader(lines(srec('0', 2, 0, 'B', 'O', 'O', 'T'), srec('1', 2, 0, 1), srec('9', 2, 0))), "image.s19", FormatAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sections[0].Name != "BOOT" {
+		t.Errorf("name %q from the S0 record, want BOOT", sections[0].Name)
+	}
+
+	sections, err = Read(strings.NewReader("\x00"), "dir/program.bin", FormatBinary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sections[0].Name != "PROGRA" {
+		t.Errorf("name %q from the file name, want PROGRA", sections[0].Name)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	data := ihex(0x00, 0x100, 1, 2)
+	badChecksum := data[:len(data)-2] + "00"
+	shortData := data[:len(data)-4] + data[len(data)-2:]
+	sdata := srec('1', 2, 0x100, 1, 2)
+
+	tests := []struct {
+		name   string
+		format Format
+		data   string
+		want   string
+	}{
+		{"ihex checksum", FormatIHex, lines(badChecksum, ihex(0x01, 0)), "f:1: Invalid checksum"},
+		{"ihex length", FormatIHex, lines(shortData, ihex(0x01, 0)), "f:1: Invalid record length"},
+		{"ihex odd digits", FormatIHex, lines(data+"0", ihex(0x01, 0)), "f:1: Invalid hex digits, encoding/hex: odd length hex string"},
+		{"ihex colon", FormatIHex, lines(data[1:], ihex(0x01, 0)), "f:1: Record does not start with a colon"},
+		{"ihex type", FormatIHex, lines(ihex(0x07, 0), ihex(0x01, 0)), "f:1: Unknown record type 07"},
+		{"ihex fixed length", FormatIHex, lines(ihex(0x04, 0, 1), ihex(0x01, 0)), "f:1: Record type 04 must have 2 bytes of data"},
+		{"ihex no end", FormatIHex, lines(data), "f:1: No end record"},
+		{"ihex after end", FormatIHex, lines(data, ihex(0x01, 0), data), "f:3: Record after the end"},
+		{"ihex no data", FormatIHex, lines(ihex(0x01, 0)), "f: No data records"},
+		{"srec checksum", FormatSRec, lines(sdata[:len(sdata)-2]+"00", srec('9', 2, 0)), "f:1: Invalid checksum"},
+		{"srec length", FormatSRec, lines("S106"+sdata[4:], srec('9', 2, 0)), "f:1: Invalid record length"},
+		{"srec type", FormatSRec, lines(sdata, "S4030000FC", srec('9', 2, 0)), "f:2: Unknown record type S4"},
+		{"srec count", FormatSRec, lines(sdata, srec('5', 2, 2), srec('9', 2, 0)), "f:2: Record count is 2, but there are 1 data records"},
+		{"srec no end", FormatSRec, lines(sdata), "f:1: No end record"},
+		{"binary empty", FormatBinary, "", "f: Empty image"},
+	}
+
+	for _, test := range tests {
+		_, err := Read(strings.NewReader(test.data), "f", test.format)
+		if err == nil {
+			t.Errorf("%s: no error, want %q", test.name, test.want)
+		} else if err.Error() != test.want {
+			t.Errorf("%s: error %q, want %q", test.name, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Loads a single line of a hexadecimal format into the section, it returns
+// whether the line is the last record
+type hexRecordFunc func(obj *ObjectCode, record string, state *hexState) (last bool, err error)
+
+// State kept between the records of a hexadecimal format
+type hexState struct {
+	// Added to the addresses of Intel HEX data records
+	base int32
+	// Number of S-record data records
+	count int32
+}
+
+// Parses Intel HEX or S-records into a single control section that covers
+// all of the data records
+func parseHexRecords(data []byte, filename string, load hexRecordFunc) ([]*ObjectCode, error) {
+	objCode := &ObjectCode{Name: sectionName(filename), headLoaded: true}
+	state := &hexState{}
+	var errs ErrorList
+	ended := false
+
+	fail := func(line int, msg string) {
+		errs = append(errs, &Error{filename, line, msg})
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := strings.TrimSpace(scanner.Text())
+		if record == "" {
+			continue
+		}
+		if ended {
+			fail(line, errAfterEnd)
+			continue
+		}
+
+		last, err := load(objCode, record, state)
+		if err != nil {
+			fail(line, err.Error())
+		}
+		ended = last
+	}
+	if err := scanner.Err(); err != nil {
+		fail(line, err.Error())
+	}
+
+	if !ended {
+		fail(line, "No end record")
+	}
+	if len(objCode.Code) == 0 && errs == nil {
+		fail(0, "No data records")
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	// The section starts at the lowest data and ends after the highest one
+	low, high := objCode.Code[0].StartAddr, int32(0)
+	for _, body := range objCode.Code {
+		if body.StartAddr < low {
+			low = body.StartAddr
+		}
+		if end := body.StartAddr + body.Length; end > high {
+			high = end
+		}
+	}
+	objCode.LoadAddr, objCode.Length = low, high-low
+	if !objCode.HasStart {
+		objCode.StartAddr = low
+	}
+	return []*ObjectCode{objCode}, nil
+}
+
+// Decodes the hexadecimal digits after the first skip characters of a record,
+// the first byte is the length of the rest, which starts at the rest index
+func decodeRecord(record string, skip int, rest int) ([]byte, error) {
+	data, err := hex.DecodeString(record[skip:])
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hex digits, %v", err)
+	}
+	if len(data) < 1 || int(data[0]) != len(data)-rest {
+		return nil, fmt.Errorf("Invalid record length")
+	}
+	return data, nil
+}
+
+// Big-endian address of the bytes
+func bigEndian(data []byte) int32 {
+	var value int32
+	for _, b := range data {
+		value = value<<8 | int32(b)
+	}
+	return value
+}
+
+// Intel HEX record :LLAAAATT followed by the data and the checksum, the sum
+// of all the bytes is 0
+func ihexRecord(obj *ObjectCode, record string, state *hexState) (bool, error) {
+	if record[0] != ':' {
+		return false, fmt.Errorf("Record does not start with a colon")
+	}
+	data, err := decodeRecord(record, 1, 5)
+	if err != nil {
+		return false, err
+	}
+
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	if sum != 0 {
+		return false, fmt.Errorf("Invalid checksum")
+	}
+
+	addr := bigEndian(data[1:3])
+	payload := data[4 : len(data)-1]
+	// Records other than data have a fixed length
+	fixed := func(length int) error {
+		if len(payload) != length {
+			return fmt.Errorf("Record type %02X must have %d bytes of data", data[3], length)
+		}
+		return nil
+	}
+
+	switch data[3] {
+	case 0x00:
+		obj.AddText(state.base+addr, payload)
+	case 0x01:
+		return true, fixed(0)
+	case 0x02:
+		// Extended segment address
+		if err := fixed(2); err != nil {
+			return false, err
+		}
+		state.base = bigEndian(payload) << 4
+	case 0x03:
+		// Start segment address, CS:IP
+		if err := fixed(4); err != nil {
+			return false, err
+		}
+		obj.SetStart(bigEndian(payload[:2])<<4 + bigEndian(payload[2:]))
+	case 0x04:
+		// Extended linear address
+		if err := fixed(2); err != nil {
+			return false, err
+		}
+		state.base = bigEndian(payload) << 16
+	case 0x05:
+		// Start linear address
+		if err := fixed(4); err != nil {
+			return false, err
+		}
+		obj.SetStart(bigEndian(payload))
+	default:
+		return false, fmt.Errorf("Unknown record type %02X", data[3])
+	}
+	return false, nil
+}
+
+// S-record STLLAAAA followed by the data and the checksum, the address has 2,
+// 3 or 4 bytes depending on the type T and the sum of all the bytes is FF
+func srecRecord(obj *ObjectCode, record string, state *hexState) (bool, error) {
+	if len(record) < 2 || record[0] != 'S' {
+		return false, fmt.Errorf("Record does not start with S")
+	}
+
+	var addrLength int
+	switch record[1] {
+	case '0', '1', '5', '9':
+		addrLength = 2
+	case '2', '6', '8':
+		addrLength = 3
+	case '3', '7':
+		addrLength = 4
+	default:
+		return false, fmt.Errorf("Unknown record type S%c", record[1])
+	}
+
+	data, err := decodeRecord(record, 2, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(data) < 2+addrLength {
+		return false, fmt.Errorf("Invalid record length")
+	}
+
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	if sum != 0xFF {
+		return false, fmt.Errorf("Invalid checksum")
+	}
+
+	addr := bigEndian(data[1 : 1+addrLength])
+	payload := data[1+addrLength : len(data)-1]
+
+	switch record[1] {
+	case '0':
+		// The header holds the name of the program
+		if name := strings.TrimSpace(strings.Trim(string(payload), "\x00")); name != "" && Detect([]byte(name)) != FormatBinary {
+			if len(name) > 6 {
+				name = name[:6]
+			}
+			obj.Name = name
+		}
+	case '1', '2', '3':
+		obj.AddText(addr, payload)
+		state.count++
+	case '5', '6':
+		if addr != state.count {
+			return false, fmt.Errorf("Record count is %d, but there are %d data records", addr, state.count)
+		}
+	case '7', '8', '9':
+		obj.SetStart(addr)
+		return true, nil
+	}
+	return false, nil
+}
@@ -1,10 +1,11 @@
 package obj
 
 import (
-	"strconv"
-	_ "encoding/hex"
-	_ "fmt"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -14,6 +15,11 @@ const (
 	errInvalidHeadFormat = "Invalid head format"
 	errInvalidBodyFormat = "Invalid body format"
 	errInvalidEndFormat  = "Invalid end format"
+	errInvalidModFormat  = "Invalid modification format"
+	errInvalidDefFormat  = "Invalid define format"
+	errInvalidRefFormat  = "Invalid refer format"
+	errHeadMissing       = "Record before the head"
+	errAfterEnd          = "Record after the end"
 )
 
 type BodyObjectCode struct {
@@ -22,101 +28,258 @@ type BodyObjectCode struct {
 	Code      []byte
 }
 
-// ObjectCode ...
+// Modification is an M record, the field of Length half-bytes at Addr is
+// changed by adding or subtracting the address of Symbol
+type Modification struct {
+	// Relative to the start of the program
+	Addr   int32
+	Length int32
+	// '+' or '-'
+	Sign byte
+	// Empty in records without a symbol, which relocate by the program
+	Symbol string
+}
+
+// Definition is an external symbol defined by a D record
+type Definition struct {
+	Name string
+	// Relative to the start of the program
+	Addr int32
+}
+
+// ObjectCode is a single control section
 type ObjectCode struct {
-	Name      string
-	Length    int32
-	LoadAddr  int32
-	StartAddr int32
-	Code      []*BodyObjectCode
+	Name          string
+	Length        int32
+	LoadAddr      int32
+	StartAddr     int32
+	Code          []*BodyObjectCode
+	Modifications []*Modification
+	Definitions   []*Definition
+	// External symbols referred to by R records
+	References []string
+	// Whether the E record has the start address, only the main section's does
+	HasStart bool
 	// Hidden
 	headLoaded bool
 	endLoaded  bool
+	// The head is missing or invalid, so the records cannot be checked against it
+	unbounded bool
 }
 
-// Load ...
+// Load loads a single record, it panics with the error of an invalid one
 func (obj *ObjectCode) Load(bytes []byte) {
-	if len(bytes) > 0 {
-		switch bytes[0] {
-		case 'H':
-			obj.loadHead(bytes)
-		case 'T':
-			obj.loadBody(bytes)
-		case 'E':
-			obj.loadEnd(bytes)
-		default:
-			panic(errInvalidFormat)
+	if err := obj.load(bytes); err != nil {
+		panic(err)
+	}
+}
+
+func (obj *ObjectCode) load(bytes []byte) error {
+	if len(bytes) == 0 {
+		return nil
+	}
+
+	if bytes[0] != 'H' && !obj.headLoaded {
+		return errors.New(errHeadMissing)
+	}
+	if obj.endLoaded {
+		if bytes[0] == 'E' {
+			return errors.New(errEndLoaded)
 		}
+		return errors.New(errAfterEnd)
+	}
+
+	switch bytes[0] {
+	case 'H':
+		return obj.loadHead(bytes)
+	case 'T':
+		return obj.loadBody(bytes)
+	case 'M':
+		return obj.loadModification(bytes)
+	case 'D':
+		return obj.loadDefinitions(bytes)
+	case 'R':
+		return obj.loadReferences(bytes)
+	case 'E':
+		return obj.loadEnd(bytes)
 	}
+	return fmt.Errorf("%s, unknown record %q", errInvalidFormat, bytes[0])
 }
 
-func (obj *ObjectCode) loadHead(str []byte) {
+// Parses a field of hexadecimal digits
+func parseHex(field []byte, name string) (int32, error) {
+	value, err := strconv.ParseUint(string(field), 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s %q", name, field)
+	}
+	return int32(value), nil
+}
+
+// Reports whether addr..addr+length-1 lies inside the section
+func (obj *ObjectCode) contains(addr int32, length int32) bool {
+	return obj.unbounded || addr >= obj.LoadAddr && addr+length <= obj.LoadAddr+obj.Length
+}
+
+func (obj *ObjectCode) loadHead(str []byte) error {
 	if obj.headLoaded {
-		panic(errHeadLoaded)
+		return errors.New(errHeadLoaded)
 	}
 
-	if len(str) < 19 || str[0] != 'H' {
-		panic(errInvalidHeadFormat)
+	if len(str) != 19 || str[0] != 'H' {
+		return fmt.Errorf("%s, expected 19 characters", errInvalidHeadFormat)
 	}
 
 	obj.Name = string(str[1:7])
 
-	if loadAddr64, err := strconv.ParseUint(string(str[7:13]), 16, 64); err == nil {
-		obj.LoadAddr = int32(loadAddr64)
-	} else {
-		panic(err)
+	var err error
+	if obj.LoadAddr, err = parseHex(str[7:13], "load address"); err != nil {
+		return err
 	}
-
-	if progLen64, err := strconv.ParseUint(string(str[13:19]), 16, 64); err == nil {
-		obj.Length = int32(progLen64)
-	} else {
-		panic(err)
+	if obj.Length, err = parseHex(str[13:19], "program length"); err != nil {
+		return err
 	}
 
 	obj.headLoaded = true
+	return nil
 }
-func (obj *ObjectCode) loadBody(str []byte) {
-	if len(str) < 10 || str[0] != 'T' {
-		panic(errInvalidBodyFormat)
+
+func (obj *ObjectCode) loadBody(str []byte) error {
+	if len(str) < 9 || str[0] != 'T' {
+		return fmt.Errorf("%s, expected at least 9 characters", errInvalidBodyFormat)
 	}
 
 	body := &BodyObjectCode{}
 
 	// Save the start address of this block
-	if startAddr64, err := strconv.ParseUint(string(str[1:7]), 16, 64); err != nil {
-		panic(err)
-	} else {
-		body.StartAddr = int32(startAddr64)
+	var err error
+	if body.StartAddr, err = parseHex(str[1:7], "start address"); err != nil {
+		return err
+	}
+	if body.Length, err = parseHex(str[7:9], "record length"); err != nil {
+		return err
 	}
 
-	if codeLen, err := strconv.ParseUint(string(str[7:9]), 16, 64); err != nil {
-		panic(err)
-	} else {
-		body.Length = int32(codeLen)
+	code := str[9:]
+	if int32(len(code)) != 2*body.Length {
+		return fmt.Errorf("%s, length is %d bytes but the record has %d hex digits", errInvalidBodyFormat, body.Length, len(code))
+	}
+	if body.Code, err = hex.DecodeString(string(code)); err != nil {
+		return fmt.Errorf("%s, %v", errInvalidBodyFormat, err)
 	}
 
-	for i := int32(0); i < 2*body.Length; i += 2 {
-		b, _ := hex.DecodeString(string(str[9 + i:9 + i + 2]))
-		// Lets just ignore the error :)
-		body.Code = append(body.Code, b[0])
+	if !obj.contains(body.StartAddr, body.Length) {
+		return fmt.Errorf("Text at %06X..%06X is outside of the program at %06X..%06X",
+			body.StartAddr, body.StartAddr+body.Length, obj.LoadAddr, obj.LoadAddr+obj.Length)
 	}
 
 	obj.Code = append(obj.Code, body)
+	return nil
 }
-func (obj *ObjectCode) loadEnd(str []byte) {
-	if obj.endLoaded {
-		panic(errEndLoaded)
+
+func (obj *ObjectCode) loadModification(str []byte) error {
+	if len(str) < 9 || str[0] != 'M' {
+		return fmt.Errorf("%s, expected at least 9 characters", errInvalidModFormat)
 	}
 
-	if len(str) < 7 || str[0] != 'E' {
-		panic(errInvalidEndFormat)
+	mod := &Modification{Sign: '+'}
+
+	var err error
+	if mod.Addr, err = parseHex(str[1:7], "modification address"); err != nil {
+		return err
+	}
+	if mod.Length, err = parseHex(str[7:9], "modification length"); err != nil {
+		return err
+	}
+	if mod.Length == 0 || mod.Length > 6 {
+		return fmt.Errorf("%s, length must be 1 to 6 half-bytes", errInvalidModFormat)
 	}
 
-	if progStart64, err := strconv.ParseUint(string(str[1:]), 16, 64); err != nil {
-		panic(err)
-	} else {
-		obj.StartAddr = int32(progStart64)
+	// The symbol form, e.g. M00000705+COPY
+	if len(str) > 9 {
+		if str[9] != '+' && str[9] != '-' {
+			return fmt.Errorf("%s, expected + or - before the symbol", errInvalidModFormat)
+		}
+		mod.Sign = str[9]
+		mod.Symbol = strings.TrimSpace(string(str[10:]))
+		if mod.Symbol == "" {
+			return fmt.Errorf("%s, the symbol is missing", errInvalidModFormat)
+		}
 	}
 
+	if !obj.contains(obj.LoadAddr+mod.Addr, (mod.Length+1)/2) {
+		return fmt.Errorf("Modification at %06X is outside of the program", mod.Addr)
+	}
+
+	obj.Modifications = append(obj.Modifications, mod)
+	return nil
+}
+
+func (obj *ObjectCode) loadDefinitions(str []byte) error {
+	// Names of 6 characters, each followed by its address
+	if len(str) < 13 || (len(str)-1)%12 != 0 || str[0] != 'D' {
+		return fmt.Errorf("%s, expected names of 6 characters each followed by an address", errInvalidDefFormat)
+	}
+
+	for i := 1; i < len(str); i += 12 {
+		def := &Definition{Name: strings.TrimSpace(string(str[i : i+6]))}
+		if def.Name == "" {
+			return fmt.Errorf("%s, the name is missing", errInvalidDefFormat)
+		}
+
+		var err error
+		if def.Addr, err = parseHex(str[i+6:i+12], "address of "+def.Name); err != nil {
+			return err
+		}
+		if !obj.contains(obj.LoadAddr+def.Addr, 0) {
+			return fmt.Errorf("Definition of %s at %06X is outside of the program", def.Name, def.Addr)
+		}
+		obj.Definitions = append(obj.Definitions, def)
+	}
+	return nil
+}
+
+func (obj *ObjectCode) loadReferences(str []byte) error {
+	if len(str) < 2 || str[0] != 'R' {
+		return fmt.Errorf("%s, expected names of 6 characters", errInvalidRefFormat)
+	}
+
+	// Names of 6 characters, the spaces after the last one may be left out
+	for i := 1; i < len(str); i += 6 {
+		end := i + 6
+		if end > len(str) {
+			end = len(str)
+		}
+		name := strings.TrimSpace(string(str[i:end]))
+		if name == "" {
+			return fmt.Errorf("%s, the name is missing", errInvalidRefFormat)
+		}
+		obj.References = append(obj.References, name)
+	}
+	return nil
+}
+
+func (obj *ObjectCode) loadEnd(str []byte) error {
+	if len(str) < 1 || str[0] != 'E' {
+		return errors.New(errInvalidEndFormat)
+	}
+
+	// Sections other than the main one end without the start address
 	obj.endLoaded = true
+	if len(str) == 1 {
+		return nil
+	}
+	if len(str) != 7 {
+		return fmt.Errorf("%s, expected 7 characters", errInvalidEndFormat)
+	}
+
+	var err error
+	if obj.StartAddr, err = parseHex(str[1:7], "start address"); err != nil {
+		return err
+	}
+	obj.HasStart = true
+
+	if !obj.contains(obj.StartAddr, 0) {
+		return fmt.Errorf("Start address %06X is outside of the program", obj.StartAddr)
+	}
+	return nil
 }
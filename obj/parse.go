@@ -0,0 +1,100 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Error is a problem of a record in an object file
+type Error struct {
+	File string
+	// Line of the record, 0 for problems of the whole file
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ErrorList is the list of all problems found in an object file
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Parse reads the control sections of an object file, each of them starts
+// with its H record and ends with its E record. Invalid records are skipped
+// and all problems are returned as an ErrorList, filename is only used in
+// the errors.
+func Parse(r io.Reader, filename string) ([]*ObjectCode, error) {
+	var sections []*ObjectCode
+	var errs ErrorList
+	var current *ObjectCode
+	// Line on which every section starts
+	var starts []int
+	orphan := false
+
+	fail := func(line int, msg string) {
+		errs = append(errs, &Error{filename, line, msg})
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		record := []byte(strings.TrimRight(scanner.Text(), "\r"))
+		if len(record) == 0 {
+			continue
+		}
+
+		switch {
+		case current == nil && record[0] != 'H':
+			// Records before the first H record are still checked, but do not form a section
+			fail(line, errHeadMissing)
+			current = &ObjectCode{headLoaded: true, unbounded: true}
+			orphan = true
+		case current == nil || (current.endLoaded || orphan) && record[0] == 'H':
+			// A new section starts with an H record after the E record of the previous one
+			current = &ObjectCode{}
+			sections = append(sections, current)
+			starts = append(starts, line)
+			orphan = false
+		}
+
+		if err := current.load(record); err != nil {
+			fail(line, err.Error())
+			// The rest of a section with an invalid head is still checked
+			if record[0] == 'H' && !current.headLoaded {
+				current.headLoaded, current.unbounded = true, true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fail(line, err.Error())
+	}
+
+	for i, cs := range sections {
+		if !cs.endLoaded {
+			fail(line, fmt.Sprintf("Section starting on line %d has no E record", starts[i]))
+		}
+	}
+	if len(sections) == 0 {
+		fail(0, "No control sections")
+	}
+
+	if errs != nil {
+		return sections, errs
+	}
+	return sections, nil
+}
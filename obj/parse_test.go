@@ -0,0 +1,82 @@
+package obj
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// Errors as file:line: message
+		want []string
+	}{
+		{"valid", "HPROG  000000000003\nT00000003010203\nE000000\n", nil},
+		{"crlf", "HPROG  000000000003\r\nT00000003010203\r\nE000000\r\n", nil},
+		{"empty", "", []string{"f: No control sections"}},
+		{"short head", "HPROG 000000000003\nE\n", []string{"f:1: Invalid head format, expected 19 characters"}},
+		{"text length", "HPROG  000000000003\nT000000030102\nE\n",
+			[]string{"f:2: Invalid body format, length is 3 bytes but the record has 4 hex digits"}},
+		{"text outside", "HPROG  000000000003\nT00000203010203\nE\n",
+			[]string{"f:2: Text at 000002..000005 is outside of the program at 000000..000003"}},
+		{"relative modification", "HPROG  001000000006\nM00000105\nE\n", nil},
+		{"modification outside", "HPROG  001000000003\nM00000305\nE\n",
+			[]string{"f:2: Modification at 000003 is outside of the program"}},
+		{"modification length", "HPROG  000000000003\nM00000007\nE\n",
+			[]string{"f:2: Invalid modification format, length must be 1 to 6 half-bytes"}},
+		{"definition outside", "HPROG  001000000003\nDLIST  000004\nE\n",
+			[]string{"f:2: Definition of LIST at 000004 is outside of the program"}},
+		{"no end", "HPROG  000000000003\nT00000003010203\n",
+			[]string{"f:2: Section starting on line 1 has no E record"}},
+		{"before head", "T00000003010203\nHPROG  000000000003\nE\n", []string{"f:1: Record before the head"}},
+		{"after end", "HPROG  000000000003\nE\nT00000003010203\n", []string{"f:3: Record after the end"}},
+		{"unknown", "HPROG  000000000003\nX\nE\n", []string{`f:2: Invalid format, unknown record 'X'`}},
+		{"start outside", "HPROG  000000000003\nE000010\n", []string{"f:2: Start address 000010 is outside of the program"}},
+		{"every error", "HPROG  000000000003\nTZZ\nM00000007\nE\n", []string{
+			"f:2: Invalid body format, expected at least 9 characters",
+			"f:3: Invalid modification format, length must be 1 to 6 half-bytes",
+		}},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test.src), "f")
+		var got []string
+		if err != nil {
+			for _, e := range err.(ErrorList) {
+				got = append(got, e.Error())
+			}
+		}
+
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s: got errors\n%s\nwant\n%s", test.name, strings.Join(got, "\n"), strings.Join(test.want, "\n"))
+		}
+	}
+}
+
+func TestParseSections(t *testing.T) {
+	src := "HMAIN  000000000006\nDENTRY 000003\nRSUB\nT00000006010203040506\nM00000105+SUB\nE000000\n" +
+		"HSUB   000000000003\nT00000003070809\nE\n"
+
+	sections, err := Parse(strings.NewReader(src), "f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sections) != 2 {
+		t.Fatalf("%d sections, want 2", len(sections))
+	}
+
+	main, sub := sections[0], sections[1]
+	if !main.HasStart || sub.HasStart {
+		t.Errorf("start addresses %v and %v", main.HasStart, sub.HasStart)
+	}
+	if len(main.Definitions) != 1 || main.Definitions[0].Name != "ENTRY" || main.Definitions[0].Addr != 3 {
+		t.Errorf("definitions %+v", main.Definitions)
+	}
+	if len(main.References) != 1 || main.References[0] != "SUB" {
+		t.Errorf("references %v", main.References)
+	}
+	if mod := main.Modifications[0]; mod.Addr != 1 || mod.Length != 5 || mod.Sign != '+' || mod.Symbol != "SUB" {
+		t.Errorf("modification %+v", mod)
+	}
+}
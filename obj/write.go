@@ -0,0 +1,127 @@
+package obj
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Maximum number of code bytes in a T record
+const maxTextLength = 0x1E
+
+// Maximum number of definitions in a D record and of names in an R record
+const (
+	maxDefinitions = 6
+	maxReferences  = 12
+)
+
+// New creates an empty control section loaded at loadAddr
+func New(name string, loadAddr int32, length int32) *ObjectCode {
+	return &ObjectCode{
+		Name:       name,
+		LoadAddr:   loadAddr,
+		Length:     length,
+		headLoaded: true,
+	}
+}
+
+// FromImage creates a control section holding the memory image loaded at
+// base, which starts executing at start
+func FromImage(name string, base int32, image []byte, start int32) *ObjectCode {
+	obj := New(name, base, int32(len(image)))
+	obj.AddText(base, image)
+	obj.SetStart(start)
+	return obj
+}
+
+// AddText adds code at addr, it continues the last text when it ends at addr
+func (obj *ObjectCode) AddText(addr int32, code []byte) {
+	if len(code) == 0 {
+		return
+	}
+
+	if n := len(obj.Code); n > 0 {
+		last := obj.Code[n-1]
+		if last.StartAddr+last.Length == addr {
+			last.Code = append(last.Code, code...)
+			last.Length += int32(len(code))
+			return
+		}
+	}
+
+	obj.Code = append(obj.Code, &BodyObjectCode{
+		StartAddr: addr,
+		Length:    int32(len(code)),
+		Code:      append([]byte(nil), code...),
+	})
+}
+
+// SetStart sets the start address written to the E record
+func (obj *ObjectCode) SetStart(addr int32) {
+	obj.StartAddr = addr
+	obj.HasStart = true
+	obj.endLoaded = true
+}
+
+// Write writes the control section as H, D, R, T, M and E records. Text is
+// split into T records of at most 30 bytes, contiguous text is joined.
+func (obj *ObjectCode) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "H%-6.6s%06X%06X\n", obj.Name, obj.LoadAddr, obj.Length)
+
+	for i := 0; i < len(obj.Definitions); i += maxDefinitions {
+		bw.WriteByte('D')
+		for _, def := range obj.Definitions[i:min(i+maxDefinitions, len(obj.Definitions))] {
+			fmt.Fprintf(bw, "%-6.6s%06X", def.Name, def.Addr)
+		}
+		bw.WriteByte('\n')
+	}
+
+	for i := 0; i < len(obj.References); i += maxReferences {
+		names := ""
+		for _, name := range obj.References[i:min(i+maxReferences, len(obj.References))] {
+			names += fmt.Sprintf("%-6.6s", name)
+		}
+		// The spaces after the last name are left out
+		fmt.Fprintf(bw, "R%s\n", strings.TrimRight(names, " "))
+	}
+
+	var start int32
+	var text []byte
+	flush := func() {
+		if len(text) > 0 {
+			fmt.Fprintf(bw, "T%06X%02X%X\n", start, len(text), text)
+		}
+		text = text[:0]
+	}
+	for _, body := range obj.Code {
+		for i, b := range body.Code {
+			addr := body.StartAddr + int32(i)
+			// Records are split when they are full or the code is not contiguous
+			if len(text) == maxTextLength || len(text) > 0 && start+int32(len(text)) != addr {
+				flush()
+			}
+			if len(text) == 0 {
+				start = addr
+			}
+			text = append(text, b)
+		}
+	}
+	flush()
+
+	for _, mod := range obj.Modifications {
+		fmt.Fprintf(bw, "M%06X%02X", mod.Addr, mod.Length)
+		if mod.Symbol != "" {
+			fmt.Fprintf(bw, "%c%s", mod.Sign, mod.Symbol)
+		}
+		bw.WriteByte('\n')
+	}
+
+	if obj.HasStart {
+		fmt.Fprintf(bw, "E%06X\n", obj.StartAddr)
+	} else {
+		bw.WriteString("E\n")
+	}
+	return bw.Flush()
+}
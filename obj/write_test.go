@@ -0,0 +1,178 @@
+package obj
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Returns the bytes of all the text by address
+func image(obj *ObjectCode) map[int32]byte {
+	cells := map[int32]byte{}
+	for _, body := range obj.Code {
+		for i, b := range body.Code {
+			cells[body.StartAddr+int32(i)] = b
+		}
+	}
+	return cells
+}
+
+func sequence(n int) []byte {
+	code := make([]byte, n)
+	for i := range code {
+		code[i] = byte(i)
+	}
+	return code
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	manyDefs := New("DEFS", 0, 0x100)
+	manyRefs := New("REFS", 0, 0x100)
+	for i := 0; i < 14; i++ {
+		manyDefs.Definitions = append(manyDefs.Definitions, &Definition{Name: fmt.Sprintf("SYM%d", i), Addr: int32(3 * i)})
+		manyRefs.References = append(manyRefs.References, fmt.Sprintf("EXT%d", i))
+	}
+	manyDefs.AddText(0, sequence(3))
+	manyRefs.AddText(0, sequence(3))
+
+	gaps := New("GAPS", 0x1000, 0x80)
+	gaps.AddText(0x1000, sequence(10))
+	gaps.AddText(0x1040, sequence(40))
+	gaps.AddText(0x1070, sequence(4))
+
+	linked := New("MAIN", 0, 0x20)
+	linked.AddText(0, sequence(0x20))
+	linked.References = []string{"SUB"}
+	linked.Modifications = []*Modification{
+		{Addr: 1, Length: 5, Sign: '+'},
+		{Addr: 4, Length: 6, Sign: '+', Symbol: "SUB"},
+		{Addr: 7, Length: 6, Sign: '-', Symbol: "MAIN"},
+	}
+	linked.SetStart(0x3)
+
+	tests := []struct {
+		name string
+		obj  *ObjectCode
+		// Number of T, D and R records
+		texts, defs, refs int
+	}{
+		{"image", FromImage("IMAGE", 0x200, sequence(100), 0x210), 4, 0, 0},
+		{"exactly one record", FromImage("ONE", 0, sequence(30), 0), 1, 0, 0},
+		{"no start", New("EMPTY", 0x300, 0), 0, 0, 0},
+		{"gaps", gaps, 4, 0, 0},
+		{"definitions", manyDefs, 1, 3, 0},
+		{"references", manyRefs, 1, 0, 2},
+		{"modifications", linked, 2, 0, 1},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := test.obj.Write(&buf); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		text := buf.String()
+
+		sections, err := Parse(strings.NewReader(text), test.name)
+		if err != nil {
+			t.Errorf("%s: %v\n%s", test.name, err, text)
+			continue
+		}
+		if len(sections) != 1 {
+			t.Errorf("%s: %d sections", test.name, len(sections))
+			continue
+		}
+		got := sections[0]
+
+		if strings.TrimSpace(got.Name) != test.obj.Name || got.LoadAddr != test.obj.LoadAddr || got.Length != test.obj.Length {
+			t.Errorf("%s: head %q %06X %06X", test.name, got.Name, got.LoadAddr, got.Length)
+		}
+		if got.HasStart != test.obj.HasStart || got.StartAddr != test.obj.StartAddr {
+			t.Errorf("%s: start %v %06X, want %v %06X", test.name, got.HasStart, got.StartAddr, test.obj.HasStart, test.obj.StartAddr)
+		}
+		if !reflect.DeepEqual(image(got), image(test.obj)) {
+			t.Errorf("%s: text differs\n%s", test.name, text)
+		}
+		if len(got.Definitions) != 0 || len(test.obj.Definitions) != 0 {
+			if !reflect.DeepEqual(got.Definitions, test.obj.Definitions) {
+				t.Errorf("%s: definitions differ\n%s", test.name, text)
+			}
+		}
+		if !reflect.DeepEqual(got.References, test.obj.References) {
+			t.Errorf("%s: references %v, want %v", test.name, got.References, test.obj.References)
+		}
+		if len(got.Modifications) != 0 || len(test.obj.Modifications) != 0 {
+			if !reflect.DeepEqual(got.Modifications, test.obj.Modifications) {
+				t.Errorf("%s: modifications differ\n%s", test.name, text)
+			}
+		}
+
+		counts := map[byte]int{}
+		for _, record := range strings.Split(strings.TrimSpace(text), "\n") {
+			counts[record[0]]++
+			if record[0] == 'T' && len(record) > 9+2*maxTextLength {
+				t.Errorf("%s: T record longer than %d bytes: %s", test.name, maxTextLength, record)
+			}
+			if len(record) > 73 {
+				t.Errorf("%s: record longer than 73 characters: %s", test.name, record)
+			}
+		}
+		if counts['T'] != test.texts || counts['D'] != test.defs || counts['R'] != test.refs {
+			t.Errorf("%s: %d T, %d D and %d R records, want %d, %d and %d\n%s", test.name,
+				counts['T'], counts['D'], counts['R'], test.texts, test.defs, test.refs, text)
+		}
+
+		// Writing the parsed section again gives the same text
+		var again bytes.Buffer
+		got.Write(&again)
+		if again.String() != text {
+			t.Errorf("%s: written again as\n%s\nwant\n%s", test.name, again.String(), text)
+		}
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	obj := FromImage("PROG", 0x1000, sequence(32), 0x1000)
+	obj.Definitions = []*Definition{{Name: "LIST", Addr: 0x10}}
+	obj.References = []string{"A", "BB"}
+	obj.Modifications = []*Modification{{Addr: 1, Length: 5, Sign: '+'}, {Addr: 4, Length: 6, Sign: '-', Symbol: "BB"}}
+
+	want := strings.Join([]string{
+		"HPROG  001000000020",
+		"DLIST  000010",
+		"RA     BB",
+		"T0010001E000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D",
+		"T00101E021E1F",
+		"M00000105",
+		"M00000406-BB",
+		"E001000",
+		"",
+	}, "\n")
+
+	var buf bytes.Buffer
+	if err := obj.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestAddText(t *testing.T) {
+	obj := New("P", 0, 0x20)
+	obj.AddText(0, []byte{1, 2})
+	obj.AddText(2, []byte{3})
+	obj.AddText(0x10, []byte{4})
+	obj.AddText(0x11, nil)
+
+	if len(obj.Code) != 2 {
+		t.Fatalf("%d bodies, want 2", len(obj.Code))
+	}
+	if body := obj.Code[0]; body.StartAddr != 0 || body.Length != 3 || !bytes.Equal(body.Code, []byte{1, 2, 3}) {
+		t.Errorf("first body %+v", body)
+	}
+	if body := obj.Code[1]; body.StartAddr != 0x10 || body.Length != 1 {
+		t.Errorf("second body %+v", body)
+	}
+}
@@ -0,0 +1,102 @@
+package opcodes
+
+// Operands of instructions
+const (
+	OperandsNone = ""      // no operand
+	OperandsM    = "m"     // a memory address, format 3 and 4 instructions
+	OperandsR1R2 = "r1,r2" // two registers
+	OperandsR1   = "r1"    // one register
+	OperandsN    = "n"     // an integer in R1
+	OperandsR1N  = "r1,n"  // a register and an integer n, encoded as n - 1 in R2
+)
+
+// Opcode describes an instruction
+type Opcode struct {
+	Mnemonic string
+	Code     uint8
+	// Format is 1, 2 or 3. Format 3 instructions can also be assembled in format 4
+	Format   int
+	Operands string
+}
+
+var (
+	// Table maps mnemonics to instructions
+	Table = map[string]*Opcode{}
+
+	// ByCode maps the top 6 bits of the opcode to instructions
+	ByCode = map[uint8]*Opcode{}
+
+	opcodes = []*Opcode{
+		{"ADD", ADD, 3, OperandsM},
+		{"ADDF", ADDF, 3, OperandsM},
+		{"ADDR", ADDR, 2, OperandsR1R2},
+		{"AND", AND, 3, OperandsM},
+		{"CLEAR", CLEAR, 2, OperandsR1},
+		{"COMP", COMP, 3, OperandsM},
+		{"COMPF", COMPF, 3, OperandsM},
+		{"COMPR", COMPR, 2, OperandsR1R2},
+		{"DIV", DIV, 3, OperandsM},
+		{"DIVF", DIVF, 3, OperandsM},
+		{"DIVR", DIVR, 2, OperandsR1R2},
+		{"FIX", FIX, 1, OperandsNone},
+		{"FLOAT", FLOAT, 1, OperandsNone},
+		{"HIO", HIO, 1, OperandsNone},
+		{"J", J, 3, OperandsM},
+		{"JEQ", JEQ, 3, OperandsM},
+		{"JGT", JGT, 3, OperandsM},
+		{"JLT", JLT, 3, OperandsM},
+		{"JSUB", JSUB, 3, OperandsM},
+		{"LDA", LDA, 3, OperandsM},
+		{"LDB", LDB, 3, OperandsM},
+		{"LDCH", LDCH, 3, OperandsM},
+		{"LDF", LDF, 3, OperandsM},
+		{"LDL", LDL, 3, OperandsM},
+		{"LDS", LDS, 3, OperandsM},
+		{"LDT", LDT, 3, OperandsM},
+		{"LDX", LDX, 3, OperandsM},
+		{"LPS", LPS, 3, OperandsM},
+		{"MUL", MUL, 3, OperandsM},
+		{"MULF", MULF, 3, OperandsM},
+		{"MULR", MULR, 2, OperandsR1R2},
+		{"NORM", NORM, 1, OperandsNone},
+		{"OR", OR, 3, OperandsM},
+		{"RD", RD, 3, OperandsM},
+		{"RMO", RMO, 2, OperandsR1R2},
+		{"RSUB", RSUB, 3, OperandsNone},
+		{"SHIFTL", SHITFTL, 2, OperandsR1N},
+		{"SHIFTR", SHIFTR, 2, OperandsR1N},
+		{"SIO", SIO, 1, OperandsNone},
+		{"SSK", SSK, 3, OperandsM},
+		{"STA", STA, 3, OperandsM},
+		{"STB", STB, 3, OperandsM},
+		{"STCH", STCH, 3, OperandsM},
+		{"STF", STF, 3, OperandsM},
+		{"STI", STI, 3, OperandsM},
+		{"STL", STL, 3, OperandsM},
+		{"STS", STS, 3, OperandsM},
+		{"STSW", STSW, 3, OperandsM},
+		{"STT", STT, 3, OperandsM},
+		{"STX", STX, 3, OperandsM},
+		{"SUB", SUB, 3, OperandsM},
+		{"SUBF", SUBF, 3, OperandsM},
+		{"SUBR", SUBR, 2, OperandsR1R2},
+		{"SVC", SVC, 2, OperandsN},
+		{"TD", TD, 3, OperandsM},
+		{"TIO", TIO, 1, OperandsNone},
+		{"TIX", TIX, 3, OperandsM},
+		{"TIXR", TIXR, 2, OperandsR1},
+		{"WD", WD, 3, OperandsM},
+	}
+)
+
+func init() {
+	for _, op := range opcodes {
+		Table[op.Mnemonic] = op
+		ByCode[op.Code] = op
+	}
+}
+
+// Registers maps register mnemonics to their numbers
+var Registers = map[string]uint8{
+	"A": 0, "X": 1, "L": 2, "B": 3, "S": 4, "T": 5, "F": 6, "PC": 8, "SW": 9,
+}
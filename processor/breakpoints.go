@@ -0,0 +1,321 @@
+package processor
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BreakpointKind ...
+type BreakpointKind int
+
+const (
+	// BreakExecute stops before the instruction at the address is executed
+	BreakExecute BreakpointKind = iota
+	// BreakRead stops after an instruction reads from the address range
+	BreakRead
+	// BreakWrite stops after an instruction writes to the address range
+	BreakWrite
+	// BreakAccess stops after an instruction reads from or writes to the address range
+	BreakAccess
+	// BreakCondition stops after an instruction that makes the condition true
+	BreakCondition
+)
+
+var (
+	breakpointNames = []string{"breakpoint", "read watchpoint", "write watchpoint", "access watchpoint", "condition"}
+)
+
+func (k BreakpointKind) String() string {
+	if int(k) < len(breakpointNames) {
+		return breakpointNames[k]
+	}
+	return fmt.Sprintf("breakpoint kind %d", int(k))
+}
+
+// Condition compares a register with a value
+type Condition struct {
+	Register int
+	// Op is one of ==, !=, <, <=, > and >=
+	Op    string
+	Value int32
+}
+
+// Evaluate ...
+func (c *Condition) Evaluate(cpu *CPU) bool {
+	v := cpu.registers[c.Register].Get()
+	switch c.Op {
+	case "==":
+		return v == c.Value
+	case "!=":
+		return v != c.Value
+	case "<":
+		return v < c.Value
+	case "<=":
+		return v <= c.Value
+	case ">":
+		return v > c.Value
+	case ">=":
+		return v >= c.Value
+	}
+	return false
+}
+
+func (c *Condition) String() string {
+	return fmt.Sprintf("%s %s %d", registerNames[c.Register], c.Op, c.Value)
+}
+
+// Breakpoint ...
+type Breakpoint struct {
+	ID   int
+	Kind BreakpointKind
+	// Address range [Address, Address + Length) of watchpoints, execute breakpoints use only Address
+	Address int32
+	Length  int32
+	// Condition that has to hold for the breakpoint to be hit, optional except for BreakCondition
+	Condition *Condition
+	// Number of times the breakpoint was hit, it stops the CPU only after IgnoreCount hits
+	Hits        int
+	IgnoreCount int
+	// Temporary breakpoints are removed after they stop the CPU
+	Temporary bool
+	Disabled  bool
+	// Whether the condition of a BreakCondition held after the last instruction
+	held bool
+}
+
+func (bp *Breakpoint) String() string {
+	str := fmt.Sprintf("%s %d at %#06x", bp.Kind, bp.ID, bp.Address)
+	if bp.Kind == BreakCondition {
+		str = fmt.Sprintf("%s %d", bp.Kind, bp.ID)
+	}
+	if bp.Condition != nil {
+		str += fmt.Sprintf(" if %s", bp.Condition)
+	}
+	return str
+}
+
+func (bp *Breakpoint) contains(addr int32) bool {
+	return addr >= bp.Address && addr < bp.Address+bp.Length
+}
+
+// Breakpoints manages the breakpoints of a CPU. They are checked only while the CPU is running.
+type Breakpoints struct {
+	mx     sync.Mutex
+	list   []*Breakpoint
+	nextID int
+}
+
+// Add adds the breakpoint and returns its ID
+func (bm *Breakpoints) Add(bp *Breakpoint) int {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	if bp.Length <= 0 {
+		bp.Length = 1
+	}
+
+	bm.nextID++
+	bp.ID = bm.nextID
+	bm.list = append(bm.list, bp)
+	return bp.ID
+}
+
+// Remove ...
+func (bm *Breakpoints) Remove(id int) bool {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	for i, bp := range bm.list {
+		if bp.ID == id {
+			bm.list = append(bm.list[:i], bm.list[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Get ...
+func (bm *Breakpoints) Get(id int) *Breakpoint {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	for _, bp := range bm.list {
+		if bp.ID == id {
+			return bp
+		}
+	}
+	return nil
+}
+
+// List ...
+func (bm *Breakpoints) List() []*Breakpoint {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+	return append([]*Breakpoint(nil), bm.list...)
+}
+
+// Clear removes all breakpoints
+func (bm *Breakpoints) Clear() {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+	bm.list = nil
+}
+
+// Returns the first breakpoint that matches and counts the hit. Temporary
+// breakpoints that stop the CPU are removed.
+func (bm *Breakpoints) hit(cpu *CPU, match func(bp *Breakpoint) bool) *Breakpoint {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	for i, bp := range bm.list {
+		if bp.Disabled || !match(bp) {
+			continue
+		}
+		if bp.Kind == BreakCondition {
+			// Only the change from false to true is a hit
+			held := bp.Condition != nil && bp.Condition.Evaluate(cpu)
+			changed := held && !bp.held
+			bp.held = held
+			if !changed {
+				continue
+			}
+		} else if bp.Condition != nil && !bp.Condition.Evaluate(cpu) {
+			continue
+		}
+
+		bp.Hits++
+		if bp.Hits <= bp.IgnoreCount {
+			continue
+		}
+
+		if bp.Temporary {
+			bm.list = append(bm.list[:i], bm.list[i+1:]...)
+		}
+		return bp
+	}
+	return nil
+}
+
+// Records whether the conditions hold when the CPU starts, a condition that
+// is already true is hit only after it becomes false and true again
+func (bm *Breakpoints) arm(cpu *CPU) {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	for _, bp := range bm.list {
+		if bp.Kind == BreakCondition {
+			bp.held = bp.Condition != nil && bp.Condition.Evaluate(cpu)
+		}
+	}
+}
+
+// Returns the first enabled breakpoint that matches, without counting a hit
+func (bm *Breakpoints) find(match func(bp *Breakpoint) bool) *Breakpoint {
+	bm.mx.Lock()
+	defer bm.mx.Unlock()
+
+	for _, bp := range bm.list {
+		if !bp.Disabled && match(bp) {
+			return bp
+		}
+	}
+	return nil
+}
+
+// Memory access by an instruction
+type access struct {
+	addr  int32
+	write bool
+}
+
+// Reports whether the watchpoint stops on the access
+func (bp *Breakpoint) watches(a access) bool {
+	switch bp.Kind {
+	case BreakRead:
+		return !a.write && bp.contains(a.addr)
+	case BreakWrite:
+		return a.write && bp.contains(a.addr)
+	case BreakAccess:
+		return bp.contains(a.addr)
+	}
+	return false
+}
+
+// StopKind ...
+type StopKind int
+
+const (
+	// StopPause is a call to Stop
+	StopPause StopKind = iota
+	// StopBreakpoint is a breakpoint or watchpoint that was hit
+	StopBreakpoint
+	// StopFault is an instruction that faulted
+	StopFault
+)
+
+// StopReason describes why the CPU stopped running
+type StopReason struct {
+	Kind       StopKind
+	Breakpoint *Breakpoint
+	// Address accessed by the instruction that hit a watchpoint
+	Address int32
+	Fault   *Fault
+}
+
+func (r *StopReason) String() string {
+	switch r.Kind {
+	case StopBreakpoint:
+		if r.Breakpoint.Kind == BreakExecute || r.Breakpoint.Kind == BreakCondition {
+			return r.Breakpoint.String()
+		}
+		return fmt.Sprintf("%s %d at %#06x", r.Breakpoint.Kind, r.Breakpoint.ID, r.Address)
+	case StopFault:
+		return "fault"
+	}
+	return "stopped"
+}
+
+// Checks the execute breakpoints before the instruction at PC is executed
+func (cpu *CPU) checkExecute() *StopReason {
+	pc := cpu.registers[RegPC].Get()
+	bp := cpu.Breakpoints.hit(cpu, func(bp *Breakpoint) bool {
+		return bp.Kind == BreakExecute && bp.Address == pc
+	})
+
+	if bp == nil {
+		return nil
+	}
+	return &StopReason{Kind: StopBreakpoint, Breakpoint: bp, Address: pc}
+}
+
+// Checks the watchpoints and conditions after an instruction was executed
+func (cpu *CPU) checkExecuted() *StopReason {
+	// A watchpoint counts one hit per instruction, however many of its bytes were accessed
+	var addr int32
+	bp := cpu.Breakpoints.hit(cpu, func(bp *Breakpoint) bool {
+		for _, a := range cpu.accesses {
+			if bp.watches(a) {
+				addr = a.addr
+				return true
+			}
+		}
+		return false
+	})
+	if bp != nil {
+		return &StopReason{Kind: StopBreakpoint, Breakpoint: bp, Address: addr}
+	}
+
+	bp = cpu.Breakpoints.hit(cpu, func(bp *Breakpoint) bool {
+		return bp.Kind == BreakCondition
+	})
+	if bp != nil {
+		return &StopReason{Kind: StopBreakpoint, Breakpoint: bp, Address: cpu.registers[RegPC].Get()}
+	}
+	return nil
+}
+
+// RunTo starts the CPU and stops it when the instruction at addr is reached
+func (cpu *CPU) RunTo(addr int32) {
+	cpu.Breakpoints.Add(&Breakpoint{Kind: BreakExecute, Address: addr, Temporary: true})
+	cpu.Start()
+}
@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"testing"
+	"time"
+)
+
+const countSource = `PROG    START   0
+        LDX     #0
+LOOP    TIX     #100
+        STX     COUNT
+        JLT     LOOP
+HALT    J       HALT
+COUNT   WORD    0
+        END     PROG
+`
+
+// Runs the CPU until it stops, it is paused if it runs for too long
+func run(t *testing.T, cpu *CPU) *StopReason {
+	t.Helper()
+	stops := make(chan *StopReason, 1)
+	cpu.OnStop = append(cpu.OnStop, func(reason *StopReason) {
+		stops <- reason
+	})
+	defer func() {
+		cpu.OnStop = cpu.OnStop[:len(cpu.OnStop)-1]
+	}()
+
+	cpu.Start()
+	select {
+	case reason := <-stops:
+		return reason
+	case <-time.After(200 * time.Millisecond):
+		cpu.Stop()
+		return <-stops
+	}
+}
+
+func TestExecuteBreakpoint(t *testing.T) {
+	cpu, program := newTestCPU(t, countSource)
+	cpu.SetSpeed(0)
+	loop := program.Symbols["LOOP"]
+	id := cpu.Breakpoints.Add(&Breakpoint{Kind: BreakExecute, Address: loop, IgnoreCount: 2})
+
+	reason := run(t, cpu)
+	if reason.Kind != StopBreakpoint || reason.Breakpoint.ID != id {
+		t.Fatalf("stopped on %s", reason)
+	}
+	if pc, x := cpu.GetRegister(RegPC), cpu.GetRegister(RegX); pc != loop || x != 2 {
+		t.Errorf("stopped at %06X with X %d, want LOOP with X 2", pc, x)
+	}
+
+	// Resuming does not stop on the breakpoint at PC again
+	if reason := run(t, cpu); reason.Kind != StopBreakpoint || cpu.GetRegister(RegX) != 3 {
+		t.Errorf("stopped on %s with X %d, want the next pass", reason, cpu.GetRegister(RegX))
+	}
+	if hits := cpu.Breakpoints.Get(id).Hits; hits != 4 {
+		t.Errorf("%d hits, want 4", hits)
+	}
+
+	cpu.Breakpoints.Get(id).Temporary = true
+	run(t, cpu)
+	if cpu.Breakpoints.Get(id) != nil {
+		t.Error("temporary breakpoint was not removed")
+	}
+}
+
+func TestWatchpoint(t *testing.T) {
+	cpu, program := newTestCPU(t, countSource)
+	cpu.SetSpeed(0)
+	count := program.Symbols["COUNT"]
+	cpu.Breakpoints.Add(&Breakpoint{Kind: BreakWrite, Address: count, Length: 3, Condition: &Condition{Register: RegX, Op: "==", Value: 7}})
+
+	reason := run(t, cpu)
+	if reason.Kind != StopBreakpoint || reason.Address != count {
+		t.Fatalf("stopped on %s", reason)
+	}
+	// It stops after the instruction that wrote
+	if v := cpu.ram.GetWord(count); v != 7 {
+		t.Errorf("COUNT %d, want 7", v)
+	}
+	if pc := cpu.GetRegister(RegPC); pc != program.Symbols["LOOP"]+6 {
+		t.Errorf("stopped at %06X, after STX", pc)
+	}
+}
+
+func TestConditionEdge(t *testing.T) {
+	cpu, _ := newTestCPU(t, countSource)
+	cpu.SetSpeed(0)
+	cpu.Breakpoints.Add(&Breakpoint{Kind: BreakCondition, Condition: &Condition{Register: RegX, Op: ">=", Value: 5}})
+
+	if reason := run(t, cpu); reason.Kind != StopBreakpoint || cpu.GetRegister(RegX) != 5 {
+		t.Fatalf("stopped on %s with X %d, want X 5", reason, cpu.GetRegister(RegX))
+	}
+
+	// The condition stays true, so the program runs to the end
+	if reason := run(t, cpu); reason.Kind != StopPause || cpu.GetRegister(RegX) != 100 {
+		t.Errorf("stopped on %s with X %d, want to be paused at the end", reason, cpu.GetRegister(RegX))
+	}
+
+	// It is hit again once it was false
+	cpu.SetRegister(RegX, 0)
+	cpu.SetRegister(RegPC, 3)
+	if reason := run(t, cpu); reason.Kind != StopBreakpoint || cpu.GetRegister(RegX) != 5 {
+		t.Errorf("stopped on %s with X %d, want X 5 again", reason, cpu.GetRegister(RegX))
+	}
+}
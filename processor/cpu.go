@@ -5,22 +5,25 @@ import (
 	"github.com/uroshercog/sic-machine/memory"
 	dev "github.com/uroshercog/sic-machine/devices"
 	reg "github.com/uroshercog/sic-machine/processor/registers"
+	"github.com/uroshercog/sic-machine/disasm"
 	"time"
 	"fmt"
 	"errors"
 	"sync"
+	"math"
 )
 
+// Register indices, format 2 instructions number PC and SW as 8 and 9
 const (
-	regA  = iota
-	regX
-	regL
-	regB
-	regS
-	regT
-	regF
-	regPC
-	regSW
+	RegA  = iota
+	RegX
+	RegL
+	RegB
+	RegS
+	RegT
+	RegF
+	RegPC
+	RegSW
 )
 
 const (
@@ -28,14 +31,13 @@ const (
 )
 
 var (
-	cmdMap = []string{"LDA", "LDX", "LDL", "STA", "STX", "STL", "ADD", "SUB",
-					  "MUL", "DIV", "COMP", "TIX", "JEQ", "JGT", "JLT", "J",
-					  "AND", "OR", "JSUB", "RSUB", "LDCH", "STCH", "ADDF", "SUBF",
-					  "MULF", "DIVF", "LDB", "LDS", "LDF", "LDT", "STB", "STS",
-					  "STF", "STT", "COMPF", "", "ADDR", "SUBR", "MULR", "DIVR",
-					  "COMPR", "SHIFTL", "SHIFTR", "RMO", "SVC", "CLEAR", "TIXR", "",
-					  "FLOAT", "FIX", "NORM", "", "LPS", "STI", "RD", "WD",
-					  "TD", "", "STSW", "SSK", "SIO", "HIO", "TIO", ""}
+	registerNames = []string{"A", "X", "L", "B", "S", "T", "F", "PC", "SW"}
+
+	// Instructions that can only be executed in supervisor mode
+	privileged = map[byte]bool{
+		oc.SIO: true, oc.HIO: true, oc.TIO: true,
+		oc.LPS: true, oc.STI: true, oc.SSK: true,
+	}
 )
 
 // CPU ...
@@ -44,181 +46,312 @@ type CPU struct {
 	registers [9]reg.Register
 	ram       *memory.RAM
 	devices   *dev.DeviceManager
+	channels  *dev.ChannelManager
 	clock     *time.Ticker
+	done      chan struct{}
 	speed     int64
 	running   bool
-	OnStart   []func()
-	OnStop    []func()
-	OnExec    []func(cmd string)
+	pending   [4][]byte
+	timer     int32
+	// Bytes and effective address of the instruction being executed
+	fetched []byte
+	address int32
+	// Memory accessed by the instruction being executed, for watchpoints
+	accesses    []access
+	watching    bool
+	skipBreak   bool
+	// Undo records of the executed instructions, nil if off
+	journal     *Journal
+	recording   *undo
+	Breakpoints *Breakpoints
+	OnStart     []func()
+	OnStop      []func(reason *StopReason)
+	OnExec  []func(inst *disasm.Instruction)
+	OnFault []func(fault *Fault)
+	// Called with every instruction that is undone
+	OnStepBack []func(inst *disasm.Instruction)
 }
 
 func (cpu *CPU) GetRegisters() []string {
 	return []string{
-		fmt.Sprintf("[A] %#x", cpu.registers[regA].Get()),
-		fmt.Sprintf("[X] %#x", cpu.registers[regX].Get()),
-		fmt.Sprintf("[L] %#x", cpu.registers[regL].Get()),
-		fmt.Sprintf("[B] %#x", cpu.registers[regB].Get()),
-		fmt.Sprintf("[S] %#x", cpu.registers[regS].Get()),
-		fmt.Sprintf("[T] %#x", cpu.registers[regT].Get()),
-		fmt.Sprintf("[F] %f", float32(cpu.registers[regF].Get())),
-		fmt.Sprintf("[PC] %#x", cpu.registers[regPC].Get()),
-		fmt.Sprintf("[SW] %#x", cpu.registers[regSW].Get()),
+		fmt.Sprintf("[A] %#x", cpu.registers[RegA].Get() & 0xFFFFFF),
+		fmt.Sprintf("[X] %#x", cpu.registers[RegX].Get() & 0xFFFFFF),
+		fmt.Sprintf("[L] %#x", cpu.registers[RegL].Get() & 0xFFFFFF),
+		fmt.Sprintf("[B] %#x", cpu.registers[RegB].Get() & 0xFFFFFF),
+		fmt.Sprintf("[S] %#x", cpu.registers[RegS].Get() & 0xFFFFFF),
+		fmt.Sprintf("[T] %#x", cpu.registers[RegT].Get() & 0xFFFFFF),
+		fmt.Sprintf("[F] %g", cpu.registers[RegF].(*reg.FloatRegister).GetFloat()),
+		fmt.Sprintf("[PC] %#x", cpu.registers[RegPC].Get() & 0xFFFFFF),
+		fmt.Sprintf("[SW] %#x", cpu.registers[RegSW].Get() & 0xFFFFFF),
 	}
 }
 
+// GetRegister returns the value of the register with the given number
+func (cpu *CPU) GetRegister(r int) int32 {
+	return cpu.registers[r].Get()
+}
+
+// SetRegister ...
+func (cpu *CPU) SetRegister(r int, value int32) {
+	cpu.registers[r].Set(value)
+}
+
+// EffectiveAddress returns the operand address of the last executed instruction, -1 if it had none
+func (cpu *CPU) EffectiveAddress() int32 {
+	return cpu.address
+}
+
+// GetFloatBits returns F in the 48-bit memory representation
+func (cpu *CPU) GetFloatBits() uint64 {
+	return cpu.registers[RegF].(*reg.FloatRegister).GetBits()
+}
+
+// SetFloatBits sets F from the 48-bit memory representation
+func (cpu *CPU) SetFloatBits(bits uint64) {
+	cpu.registers[RegF].(*reg.FloatRegister).SetBits(bits)
+}
+
 func (cpu *CPU) SetStart(start int32) {
 	cpu.ram.ValidAddress(start)
-	cpu.registers[regPC].Set(start)
-}
-
-// Run ...
-func (cpu *CPU) run() byte {
-	pcReg := cpu.registers[regPC]
-
-	var command, operand byte
-
-	// Load the first byte from the memory (from location in PC)
-	command = cpu.ram.GetByte(pcReg.Get())
-	pcReg.Add(0x1)
-	// Command is 8 bits
-	if executed := cpu.executeF1(command); executed {
-		// The command was format 1
-		// Increment the program counter by the number of bytes used in the instruction
-		return command
-	}
-
-	// Load another byte
-	operand = cpu.ram.GetByte(pcReg.Get())
-	pcReg.Add(0x1)
-
-	// Check if the two bytes represent a command and an operand
-	if executed := cpu.executeF2(command, int32(operand)); executed {
-		// The command was format 2
-		// Increment the program counter by the number of bytes used in the instruction
-		return command
-	}
-
-	// Load a third byte
-	operandEx := (int32(operand) << 8) | int32(cpu.ram.GetByte(pcReg.Get()))
-	pcReg.Add(0x1)
-
-	// Parse the bits in the command and the operand
-	// The operand in SIC, F3 and F4 is 6 bits, last two bits are N (indirect addressing) and I (immediate addressing)
-	bits := map[string]bool{
-		// command: _ _ _ _ n i
-		"n": (command & 0x2) > 0,
-		"i": (command & 0x1) > 0,
-		// operand: x b p e _ _ ...
-		"x": (operandEx & 0x8000) > 0,
-		"b": (operandEx & 0x4000) > 0,
-		"p": (operandEx & 0x2000) > 0,
-		"e": (operandEx & 0x1000) > 0,
-	}
-
-	// If bits n and i are 0 that means SIC format
-	// Otherwise its F3 or F4
-
-	if !bits["n"] && !bits["i"] {
-		// SIC format
-		// 8 bit operand, (bottom) 15 bit operand
-		operandEx &= 0x7FFF
-	} else if bits["e"] {
-		// Extended -> format 4
-		// Operand is (bottom) 20 bits
-
-		// Load the 4th byte
-		operandEx = (operandEx << 8) | int32(cpu.ram.GetByte(pcReg.Get()))
-		pcReg.Add(0x1)
-		// Format 4 operand is bottom 20 bits
-		operandEx &= 0xFFFFF
-		// Increment the PC counter by one because we loaded an additional byte as part of the operand value
-
-		if executed := cpu.execute(command, operandEx, bits); executed {
-			return command
-		} else {
-			panic("Format 4 command was not executed")
-		}
-	} else {
-		// Format 3
-		// Check if its PC relative addressing
-		if bits["p"] {
-			if operandEx >= 2048 {
-				operandEx -= 4096
+	cpu.registers[RegPC].Set(start)
+}
+
+// Run executes a single instruction. Faults are turned into program
+// interrupts when possible, otherwise they are returned and the PC is left
+// at the faulting instruction.
+func (cpu *CPU) run() (inst *disasm.Instruction, err error) {
+	pcReg := cpu.registers[RegPC]
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+	start := pcReg.Get()
+
+	cpu.fetched = cpu.fetched[:0]
+	cpu.accesses = cpu.accesses[:0]
+	cpu.address = -1
+
+	// Memory accesses of this instruction are checked against the mode and ID of the process
+	cpu.ram.SetAccess(sw.IsSupervisor(), sw.GetID())
+	defer func() {
+		cpu.watching = false
+		if r := recover(); r != nil {
+			fault := cpu.toFault(r, start)
+			if code, ok := faultICodes[fault.Kind]; ok && sw.IsEnabled(IntProgram) {
+				cpu.Interrupt(IntProgram, code)
+			} else {
+				pcReg.Set(start)
+				err = fault
 			}
-			operandEx += pcReg.Get()
-		} else if bits["b"] {
-			// Check its base relative addressing
-			operandEx += cpu.registers[regB].Get()
-		} else if bits["p"] && bits["b"] {
-			// It cannot be PC and base relative at the same time
-			panic("Invalid addressing: PC and base")
 		}
+	}()
+
+	// Load the instruction from the memory (from location in PC)
+	if inst, err = disasm.DecodeFrom(start, cpu.fetch); err != nil {
+		cpu.fault(FaultInvalidOpcode, err.Error())
+	}
+	// Increment the program counter by the number of bytes used in the instruction
+	pcReg.Set(start + inst.Length)
+	cpu.watching = true
+
+	executed := false
+	switch inst.Format {
+	case 1:
+		executed = cpu.executeF1(inst.Opcode)
+	case 2:
+		// Upper 4 bits are R1 and lower 4 bits are R2
+		executed = cpu.executeF2(inst.Opcode, int32(inst.R1)<<4|int32(inst.R2))
+	default:
+		address, err := inst.Resolve(cpu.registers[RegB].Get(), cpu.registers[RegX].Get())
+		if err != nil {
+			cpu.fault(FaultInvalidAddressing, err.Error())
+		}
+		cpu.address = address
+
+		flags := map[string]bool{
+			"n": inst.N,
+			"i": inst.I,
+			"x": inst.X,
+			"b": inst.B,
+			"p": inst.P,
+			"e": inst.E,
+		}
+		executed = cpu.execute(inst.Opcode, address, flags)
 	}
 
-	if bits["x"] {
-		// Check if its indexed addressing
-		if bits["n"] && bits["i"] || !bits["n"] && !bits["i"] {
-			operandEx += cpu.registers[regX].Get()
-		} else {
-			panic("Invalid addressing: indexed")
+	if !executed {
+		cpu.fault(FaultInvalidOpcode, fmt.Sprintf("Format %d command was not executed", inst.Format))
+	}
+	return inst, nil
+}
+
+// Loads a byte of the instruction
+func (cpu *CPU) fetch(addr int32) (byte, error) {
+	b := cpu.ram.GetByte(addr)
+	cpu.fetched = append(cpu.fetched, b)
+	return b, nil
+}
+
+// Executes a single instruction, or only waits for an interrupt when the CPU is idle
+func (cpu *CPU) tick() error {
+	if cpu.running {
+		// The breakpoint the CPU was started from is not hit again
+		skip := cpu.skipBreak
+		cpu.skipBreak = false
+		if !skip {
+			if reason := cpu.checkExecute(); reason != nil {
+				cpu.stop(reason)
+				return nil
+			}
+		}
+	}
+
+	cpu.beginUndo()
+	defer cpu.endUndo()
+
+	executed := !cpu.registers[RegSW].(*reg.SwRegister).IsIdle()
+
+	var inst *disasm.Instruction
+	if executed {
+		var err error
+		if inst, err = cpu.run(); err != nil {
+			// The guest crashed, the CPU stops at the faulting instruction
+			cpu.stop(&StopReason{Kind: StopFault, Fault: err.(*Fault)})
+			for _, f := range cpu.OnFault {
+				f(err.(*Fault))
+			}
+			return err
 		}
 	}
 
-	// The operand is only the top 6 bits
-	command &= 0xFC
-	// The operand is only bottom 12 bits (offset/displacement)
-	operandEx &= 0xFFF
+	if !executed {
+		cpu.accesses = cpu.accesses[:0]
+	}
+
+	// Bytes the channels write are watched as if the instruction wrote them
+	cpu.watching = true
+	cpu.channels.Tick()
+	cpu.watching = false
+
+	cpu.tickTimer()
+	cpu.handleInterrupts()
+
+	if cpu.recording != nil {
+		cpu.recording.inst = inst
+	}
+
+	// Instructions that raised a program interrupt while being fetched are not reported
+	if inst != nil {
+		for _, f := range cpu.OnExec {
+			f(inst)
+		}
+	}
+
+	if cpu.running && (inst != nil || len(cpu.accesses) > 0) {
+		if reason := cpu.checkExecuted(); reason != nil {
+			cpu.stop(reason)
+		}
+	}
+	return nil
+}
 
-	if executed := cpu.execute(command, operandEx, bits); !executed {
-		panic("Format 3 command was not executed")
+// Faults the instruction if the command is privileged and the CPU is in user mode
+func (cpu *CPU) checkPrivileged(command byte) {
+	if privileged[command] && !cpu.registers[RegSW].(*reg.SwRegister).IsSupervisor() {
+		cpu.fault(FaultPrivilegedInstruction, "Privileged instruction in user mode")
 	}
-	return command
 }
 
 // Starts the CPU clock
 func (cpu *CPU) Start() {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
 	if !cpu.running {
 		cpu.running = true
-		// Create a new ticker
-		cpu.clock = time.NewTicker(time.Duration(nanoseconds / cpu.speed))
+		cpu.skipBreak = true
+		cpu.Breakpoints.arm(cpu)
+		cpu.done = make(chan struct{})
+
+		// Create a new ticker, without one the CPU runs as fast as possible
+		var clock <-chan time.Time
+		if cpu.speed > 0 {
+			cpu.clock = time.NewTicker(time.Duration(nanoseconds / cpu.speed))
+			clock = cpu.clock.C
+		}
 
 		for _, f := range cpu.OnStart {
 			f()
 		}
 
-		go func() {
-			for range cpu.clock.C {
-				cmd := cpu.run()
-				for _, f := range cpu.OnExec {
-					f(cmdMap[cmd >> 2])
+		go func(clock <-chan time.Time, done <-chan struct{}) {
+			for {
+				if clock != nil {
+					select {
+					case <-done:
+						return
+					case <-clock:
+					}
+				}
+
+				select {
+				case <-done:
+					return
+				default:
+					cpu.mx.Lock()
+					// The CPU could have been stopped while waiting for the lock
+					select {
+					case <-done:
+					default:
+						cpu.tick()
+					}
+					cpu.mx.Unlock()
 				}
 			}
-		}()
+		}(clock, cpu.done)
 	}
 }
 
 // Pauses the cpu clock, for breakpoints or w/e
 func (cpu *CPU) Stop() {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+	cpu.stop(&StopReason{Kind: StopPause})
+}
+
+func (cpu *CPU) stop(reason *StopReason) {
 	if cpu.running {
 		cpu.running = false
-		cpu.clock.Stop()
+		if cpu.clock != nil {
+			cpu.clock.Stop()
+			cpu.clock = nil
+		}
+		close(cpu.done)
 		for _, f := range cpu.OnStop {
-			f()
+			f(reason)
 		}
 	}
 }
 
 // Step ...
 func (cpu *CPU) Step() {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
 	if !cpu.running {
-		cmd := cpu.run()
-		for _, f := range cpu.OnExec {
-			f(cmdMap[cmd >> 2])
-		}
+		cpu.tick()
 	}
 }
 
-// SetSpeed ...
+// Exec executes a single instruction without the clock and returns the fault that stopped it
+func (cpu *CPU) Exec() error {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	if cpu.running {
+		return errors.New("CPU is running")
+	}
+	return cpu.tick()
+}
+
+// SetSpeed sets the number of instructions per second, 0 runs the CPU as fast as possible
 func (cpu *CPU) SetSpeed(speed int64) error {
 	if speed < 0 {
 		return errors.New("Speed must be positive")
@@ -233,30 +366,47 @@ func (cpu *CPU) IsRunning() bool {
 	return cpu.running
 }
 
+// IsIdle reports whether the CPU is waiting for an interrupt
+func (cpu *CPU) IsIdle() bool {
+	return cpu.registers[RegSW].(*reg.SwRegister).IsIdle()
+}
+
 func (cpu *CPU) executeF1(command byte) bool {
+	switch command {
+	case oc.SIO, oc.HIO, oc.TIO:
+		cpu.checkPrivileged(command)
+	}
+
 	switch command {
 	case oc.FIX:
-		// Move register F to A and convert to integer
-		//f := cpu.registers[regF].(reg.FloatRegister).GetFloat()
-		//cpu.registers[regA].Set(int32(f))
-		panic("Not implemented")
+		// Move register F to A and convert to integer, the fraction is truncated
+		f := math.Trunc(cpu.registers[RegF].(*reg.FloatRegister).GetFloat())
+		// Written so that NaN does not pass either
+		if !(f >= -(1<<23) && f <= 1<<23-1) {
+			cpu.fault(FaultOverflow, fmt.Sprintf("%g does not fit into register A", f))
+		}
+		cpu.registers[RegA].Set(int32(f))
 	case oc.FLOAT:
 		// Move register A to F and convert to float
-		//a := cpu.registers[regA].Get()
-		//cpu.registers[regB].(reg.FloatRegister).SetFloat(float32(a))
-		panic("Not implemented")
+		a := cpu.registers[RegA].Get()
+		cpu.registers[RegF].(*reg.FloatRegister).SetFloat(float64(a))
 	case oc.HIO:
 		// Halt I/O channel no. (A)
-		panic("Not implemented")
+		cpu.setChannelCC(cpu.channels.Halt(cpu.channelNumber()))
 	case oc.NORM:
-		// Normalize F and save to F
-		panic("Not implemented")
+		// Normalize F and save to F, a no-op since F is normalized when it is loaded
+		cpu.registers[RegF].(*reg.FloatRegister).Normalize()
 	case oc.SIO:
 		// Start I/O channel number (A). Address of channel if given in S.
-		panic("Not implemented")
+		sw := cpu.registers[RegSW].(*reg.SwRegister)
+		if cpu.channels.Start(cpu.channelNumber(), cpu.registers[RegS].Get()) {
+			sw.SetEqual()
+		} else {
+			sw.SetLess()
+		}
 	case oc.TIO:
 		// Test I/O channel number (A)
-		panic("Not implemented")
+		cpu.setChannelCC(cpu.channels.Status(cpu.channelNumber()))
 	default:
 		return false
 	}
@@ -270,200 +420,294 @@ func (cpu *CPU) executeF2(command byte, operand int32) bool {
 	case oc.ADDR:
 		//R2 <- (R2) + (R1)
 		// Load one more byte, upper 4 bits are R1 and lower 4 bits are R2
-		cpu.registers[v2].Add(cpu.registers[v1].Get())
+		cpu.register(v2).Add(cpu.register(v1).Get())
 	case oc.CLEAR:
-		cpu.registers[v1].Clear()
+		cpu.register(v1).Clear()
 	case oc.COMPR:
 		// Load one more byte, upper 4 bits are R1 and lower 4 bits
-		sw := cpu.registers[regSW].(*reg.SwRegister)
-		sw.Compare(cpu.registers[v1].Get(), cpu.registers[v2].Get())
+		sw := cpu.registers[RegSW].(*reg.SwRegister)
+		sw.Compare(cpu.register(v1).Get(), cpu.register(v2).Get())
 	case oc.DIVR:
-		//R2 <- (R2) + (R1)
+		//R2 <- (R2) / (R1)
 		// Load one more byte, upper 4 bits are R1 and lower 4 bits are R2
-		cpu.registers[v2].Divide(cpu.registers[v1].Get())
+		cpu.register(v2).Divide(cpu.divisor(cpu.register(v1).Get()))
 	case oc.MULR:
 		//R2 <- (R2) * (R1)
 		// Load one more byte, upper 4 bits are R1 and lower 4 bits are R2
-		cpu.registers[v2].Multiply(cpu.registers[v1].Get())
+		cpu.register(v2).Multiply(cpu.register(v1).Get())
 	case oc.RMO:
 		//R2 <- (R1)
 		// Load one more byte, upper 4 bits are R1 and lower 4 bits are R2
-		cpu.registers[v2].Set(cpu.registers[v1].Get())
+		cpu.register(v2).Set(cpu.register(v1).Get())
 	case oc.SHIFTR:
-		cpu.registers[v1].ShiftRight(uint32(v2))
+		// The shift count n is encoded as n - 1 in R2
+		cpu.register(v1).ShiftRight(uint32(v2) + 1)
 	case oc.SHITFTL:
-		cpu.registers[v1].ShiftLeft(uint32(v2))
+		// The shift count n is encoded as n - 1 in R2
+		cpu.register(v1).ShiftLeft(uint32(v2) + 1)
 	case oc.SUBR:
-		cpu.registers[v2].Sub(cpu.registers[v1].Get())
+		cpu.register(v2).Sub(cpu.register(v1).Get())
 	case oc.SVC:
-		panic("Not implemented")
+		// Generate a SVC interrupt, the code is given in R1
+		cpu.Interrupt(IntSVC, byte(v1))
 	case oc.TIXR:
-		panic("Not implemented")
+		// X <- (X) + 1; (X) : (R1)
+		cpu.registers[RegX].Add(0x1)
+		sw := cpu.registers[RegSW].(*reg.SwRegister)
+		sw.Compare(cpu.registers[RegX].Get(), cpu.register(v1).Get())
 	default:
 		return false
 	}
 	return true
 }
 func (cpu *CPU) execute(command byte, operand int32, flags map[string]bool) bool {
+	cpu.checkPrivileged(command)
+
 	switch command {
 	case oc.ADD:
 		// A <- (A) + (m..m + 2)
-		cpu.registers[regA].Add(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].Add(cpu.resolveWordOperand(operand, flags))
 	case oc.ADDF:
-		panic("Not implemented")
+		// F <- (F) + (m..m + 5)
+		f := cpu.registers[RegF].(*reg.FloatRegister)
+		f.SetFloat(f.GetFloat() + cpu.resolveFloatOperand(operand, flags))
 	case oc.AND:
 		// A <- (A) + (m..m + 2)
-		cpu.registers[regA].And(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].And(cpu.resolveWordOperand(operand, flags))
 	case oc.COMP:
-		sw := cpu.registers[regSW].(*reg.SwRegister)
-		sw.Compare(cpu.registers[regA].Get(), cpu.resolveWordOperand(operand, flags))
+		sw := cpu.registers[RegSW].(*reg.SwRegister)
+		sw.Compare(cpu.registers[RegA].Get(), cpu.resolveWordOperand(operand, flags))
 	case oc.COMPF:
-		panic("Not implemented")
+		sw := cpu.registers[RegSW].(*reg.SwRegister)
+		f := cpu.registers[RegF].(*reg.FloatRegister)
+		sw.CompareFloat(f.GetFloat(), cpu.resolveFloatOperand(operand, flags))
 	case oc.DIV:
-		cpu.registers[regA].Divide(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].Divide(cpu.divisor(cpu.resolveWordOperand(operand, flags)))
 	case oc.DIVF:
-		panic("Not implemented")
+		// F <- (F) / (m..m + 5)
+		f := cpu.registers[RegF].(*reg.FloatRegister)
+		divisor := cpu.resolveFloatOperand(operand, flags)
+		if divisor == 0 {
+			cpu.fault(FaultDivisionByZero, "Division by zero")
+		}
+		f.SetFloat(f.GetFloat() / divisor)
 	case oc.J:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.registers[regPC].Set(operand)
+		cpu.registers[RegPC].Set(operand)
 	case oc.JEQ:
-		r := cpu.registers[regSW].(*reg.SwRegister)
+		r := cpu.registers[RegSW].(*reg.SwRegister)
 		if r.IsEqual() {
 			if flags["n"] && !flags["i"] {
 				operand = cpu.ram.GetWord(operand)
 			}
-			cpu.registers[regPC].Set(operand)
+			cpu.registers[RegPC].Set(operand)
 		}
 	case oc.JGT:
-		r := cpu.registers[regSW].(*reg.SwRegister)
+		r := cpu.registers[RegSW].(*reg.SwRegister)
 		if r.IsGreater() {
 			if flags["n"] && !flags["i"] {
 				operand = cpu.ram.GetWord(operand)
 			}
-			cpu.registers[regPC].Set(operand)
+			cpu.registers[RegPC].Set(operand)
 		}
-		r.Clear()
 	case oc.JLT:
-		r := cpu.registers[regSW].(*reg.SwRegister)
+		r := cpu.registers[RegSW].(*reg.SwRegister)
 		if r.IsLess() {
 			if flags["n"] && !flags["i"] {
 				operand = cpu.ram.GetWord(operand)
 			}
-			cpu.registers[regPC].Set(operand)
+			cpu.registers[RegPC].Set(operand)
 		}
-		r.Clear()
 	case oc.JSUB:
-		cpu.registers[regL].Set(cpu.registers[regPC].Get())
+		cpu.registers[RegL].Set(cpu.registers[RegPC].Get())
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.registers[regPC].Set(operand)
+		cpu.registers[RegPC].Set(operand)
 	case oc.LDA:
 		// 	Load from memory location <operand>
-		cpu.registers[regA].Set(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].Set(cpu.resolveWordOperand(operand, flags))
 	case oc.LDB:
 		// 	Load from memory location <operand>
-		cpu.registers[regB].Set(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegB].Set(cpu.resolveWordOperand(operand, flags))
 	case oc.LDCH:
 		// 	Load from memory location <operand>
-		cpu.registers[regA].Set(int32(cpu.resolveByteOperand(operand, flags) & 0xFF))
+		cpu.registers[RegA].Set(int32(cpu.resolveByteOperand(operand, flags) & 0xFF))
 	case oc.LDF:
-		panic("Not implemented")
+		// 	Load from memory location <operand>
+		cpu.registers[RegF].(*reg.FloatRegister).SetFloat(cpu.resolveFloatOperand(operand, flags))
 	case oc.LDL:
 		// 	Load from memory location <operand>
-		cpu.registers[regL].Set(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegL].Set(cpu.resolveWordOperand(operand, flags))
 	case oc.LDS:
 		// 	Load from memory location <operand>
-		cpu.registers[regS].Set(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegS].Set(cpu.resolveWordOperand(operand, flags))
 	case oc.LDT:
 		// 	Load from memory location <operand>
-		cpu.registers[regT].Set(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegT].Set(cpu.resolveWordOperand(operand, flags))
 	case oc.LDX:
 		// 	Load from memory location <operand>
-		cpu.registers[regX].Set(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegX].Set(cpu.resolveWordOperand(operand, flags))
 	case oc.LPS:
-		panic("Not implemented")
+		// Load processor status from (m..m + 29)
+		if flags["n"] && !flags["i"] {
+			operand = cpu.ram.GetWord(operand)
+		}
+		cpu.loadStatus(operand)
 	case oc.MUL:
-		cpu.registers[regA].Multiply(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].Multiply(cpu.resolveWordOperand(operand, flags))
 	case oc.MULF:
-		panic("Not implemented")
+		// F <- (F) * (m..m + 5)
+		f := cpu.registers[RegF].(*reg.FloatRegister)
+		f.SetFloat(f.GetFloat() * cpu.resolveFloatOperand(operand, flags))
 	case oc.OR:
-		cpu.registers[regA].Or(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].Or(cpu.resolveWordOperand(operand, flags))
 	case oc.RD:
-		if m, err := cpu.devices.Get(byte(operand)).Read(); err == nil {
-			cpu.registers[regA].Set(int32(m))
+		if m, err := cpu.devices.Read(cpu.resolveByteOperand(operand, flags)); err == nil {
+			cpu.registers[RegA].Set(int32(m))
 		} else {
-			panic(err)
+			cpu.fault(FaultDevice, err.Error())
 		}
 	case oc.RSUB:
-		cpu.registers[regPC].Set(cpu.registers[regL].Get())
+		cpu.registers[RegPC].Set(cpu.registers[RegL].Get())
 	case oc.SSK:
-		panic("Not implemented")
+		// Protection key for address m <- (A)
+		if flags["n"] && !flags["i"] {
+			operand = cpu.ram.GetWord(operand)
+		}
+		cpu.ram.SetKey(operand, byte(cpu.registers[RegA].Get() & 0xF))
 	case oc.STA:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regA].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegA].Get())
 	case oc.STB:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regB].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegB].Get())
 	case oc.STCH:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetByte(operand, byte(cpu.registers[regA].Get()))
+		cpu.ram.SetByte(operand, byte(cpu.registers[RegA].Get()))
 	case oc.STF:
-		panic("Not implemented")
+		if flags["n"] && !flags["i"] {
+			operand = cpu.ram.GetWord(operand)
+		}
+		cpu.ram.SetFloat(operand, cpu.registers[RegF].(*reg.FloatRegister).GetBits())
 	case oc.STI:
-		panic("Not implemented")
+		// Set the interval timer to (m..m + 2)
+		cpu.timer = cpu.resolveWordOperand(operand, flags)
 	case oc.STL:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regL].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegL].Get())
 	case oc.STS:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regS].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegS].Get())
 	case oc.STSW:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regSW].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegSW].Get())
 	case oc.STT:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regT].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegT].Get())
 	case oc.STX:
 		if flags["n"] && !flags["i"] {
 			operand = cpu.ram.GetWord(operand)
 		}
-		cpu.ram.SetWord(operand, cpu.registers[regX].Get())
+		cpu.ram.SetWord(operand, cpu.registers[RegX].Get())
 	case oc.SUB:
 		//R2 <- (R2) - (R1)
 		// Load one more byte, upper 4 bits are R1 and lower 4 bits are R2
-		cpu.registers[regA].Sub(cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegA].Sub(cpu.resolveWordOperand(operand, flags))
 	case oc.SUBF:
-		panic("Not implemented")
+		// F <- (F) - (m..m + 5)
+		f := cpu.registers[RegF].(*reg.FloatRegister)
+		f.SetFloat(f.GetFloat() - cpu.resolveFloatOperand(operand, flags))
 	case oc.TD:
-		panic("Not implemented")
+		// CC is < if the device is ready, = if it is busy and > if its input has ended
+		ready, ended, err := cpu.devices.Test(cpu.resolveByteOperand(operand, flags))
+		if err != nil {
+			cpu.fault(FaultDevice, err.Error())
+		}
+		if ready {
+			cpu.registers[RegSW].(*reg.SwRegister).SetLess()
+		} else if ended {
+			cpu.registers[RegSW].(*reg.SwRegister).SetGreater()
+		} else {
+			cpu.registers[RegSW].(*reg.SwRegister).SetEqual()
+		}
 	case oc.TIX:
-		cpu.registers[regX].Add(0x1)
-		cpu.registers[regSW].(*reg.SwRegister).Compare(cpu.registers[regX].Get(), cpu.resolveWordOperand(operand, flags))
+		cpu.registers[RegX].Add(0x1)
+		cpu.registers[RegSW].(*reg.SwRegister).Compare(cpu.registers[RegX].Get(), cpu.resolveWordOperand(operand, flags))
 	case oc.WD:
-		cpu.devices.Get(cpu.resolveByteOperand(operand, flags)).Write(byte(cpu.registers[regA].Get()))
+		if err := cpu.device(cpu.resolveByteOperand(operand, flags)).Write(byte(cpu.registers[RegA].Get())); err != nil {
+			cpu.fault(FaultDevice, err.Error())
+		}
 	default:
 		return false
 	}
 	return true
 }
 
+// Returns the register with the number n of a format 2 instruction
+func (cpu *CPU) register(n int32) reg.Register {
+	switch {
+	case n < RegPC:
+		return cpu.registers[n]
+	case n == 8:
+		return cpu.registers[RegPC]
+	case n == 9:
+		return cpu.registers[RegSW]
+	}
+	cpu.fault(FaultInvalidOpcode, fmt.Sprintf("Invalid register %d", n))
+	return nil
+}
+
+// Returns the divisor, or faults the instruction if it is zero
+func (cpu *CPU) divisor(value int32) int32 {
+	if value == 0 {
+		cpu.fault(FaultDivisionByZero, "Division by zero")
+	}
+	return value
+}
+
+// Returns the device, or faults the instruction if it cannot be opened
+func (cpu *CPU) device(fd byte) dev.Device {
+	d, err := cpu.devices.Get(fd)
+	if err != nil {
+		cpu.fault(FaultDevice, err.Error())
+	}
+	return d
+}
+
+func (cpu *CPU) channelNumber() byte {
+	return byte(cpu.registers[RegA].Get() & 0xF)
+}
+
+// Sets CC to = if the channel is idle, < if it is busy and > if its last program failed
+func (cpu *CPU) setChannelCC(status dev.ChannelStatus) {
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+	switch status {
+	case dev.ChannelIdle:
+		sw.SetEqual()
+	case dev.ChannelBusy:
+		sw.SetLess()
+	default:
+		sw.SetGreater()
+	}
+}
+
 // Takes an operand and determines the actual value of the operand
 func (cpu *CPU) resolveWordOperand(operand int32, flags map[string]bool) int32 {
 	if flags["i"] && !flags["n"] {
@@ -491,6 +735,19 @@ func (cpu *CPU) resolveByteOperand(operand int32, flags map[string]bool) byte {
 	return cpu.ram.GetByte(operand)
 }
 
+// Takes an operand and determines the 48-bit floating point value it refers to
+func (cpu *CPU) resolveFloatOperand(operand int32, flags map[string]bool) float64 {
+	if flags["i"] && !flags["n"] {
+		return float64(operand)
+	}
+
+	if flags["n"] && !flags["i"] {
+		operand = cpu.ram.GetWord(operand)
+	}
+
+	return reg.DecodeFloat(cpu.ram.GetFloat(operand))
+}
+
 // New ...
 func NewCPU(ram *memory.RAM, devices *dev.DeviceManager) *CPU {
 	registers := [...]reg.Register{
@@ -506,15 +763,55 @@ func NewCPU(ram *memory.RAM, devices *dev.DeviceManager) *CPU {
 	}
 
 	ret := &CPU{
-		registers: registers,
-		ram:       ram,
-		devices:   devices,
-		clock:     nil,
-		OnStart:   []func(){},
-		OnStop:    []func(){},
-		OnExec:    []func(cmd string){},
+		registers:   registers,
+		ram:         ram,
+		devices:     devices,
+		channels:    dev.NewChannelManager(ram, devices),
+		clock:       nil,
+		Breakpoints: &Breakpoints{},
+		OnStart:     []func(){},
+		OnStop:      []func(reason *StopReason){},
+		OnExec:      []func(inst *disasm.Instruction){},
+		OnFault:     []func(fault *Fault){},
+		OnStepBack:  []func(inst *disasm.Instruction){},
 	}
 
+	// Accesses of the executing instruction are recorded for the watchpoints
+	ram.OnRead = append(ram.OnRead, func(addr int32) {
+		if ret.watching {
+			ret.accesses = append(ret.accesses, access{addr, false})
+		}
+	})
+	ram.OnWrite = append(ram.OnWrite, func(addr int32, value byte) {
+		if ret.watching {
+			ret.accesses = append(ret.accesses, access{addr, true})
+		}
+		if ret.recording != nil {
+			ret.recording.writes = append(ret.recording.writes, overwrite{addr, ram.GetRaw()[addr]})
+		}
+	})
+	devices.OnRead = append(devices.OnRead, func(fd byte, value byte) {
+		if ret.recording != nil {
+			ret.recording.reads = append(ret.recording.reads, deviceRead{fd, value})
+		}
+	})
+
+	// Device input is logged and replayed by the number of executed instructions
+	ret.OnExec = append(ret.OnExec, func(inst *disasm.Instruction) {
+		devices.Step()
+	})
+	ret.OnStepBack = append(ret.OnStepBack, func(inst *disasm.Instruction) {
+		devices.StepBack()
+	})
+
+	// Finished channel programs raise an I/O interrupt with the channel number as the code
+	ret.channels.OnComplete = append(ret.channels.OnComplete, func(channel byte) {
+		ret.Interrupt(IntIO, channel)
+	})
+
+	// The machine starts in supervisor mode with all interrupts masked
+	registers[RegSW].(*reg.SwRegister).SetSupervisor(true)
+
 	ret.SetSpeed(10000) // Number of operations/s
 	return ret
 }
@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/uroshercog/sic-machine/asm"
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+)
+
+// Assembles the source and loads it into a new CPU that starts at its entry
+func newTestCPU(t *testing.T, src string) (*CPU, *asm.Program) {
+	t.Helper()
+	program, err := asm.Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := program.WriteObject(&buf); err != nil {
+		t.Fatal(err)
+	}
+	sections, err := obj.Parse(&buf, "test.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ram := memory.New()
+	ram.Load(sections[0])
+	cpu := NewCPU(ram, dev.New())
+	cpu.SetStart(program.Entry)
+	return cpu, program
+}
+
+// Executes n instructions, none of them may fault
+func execute(t *testing.T, cpu *CPU, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := cpu.Exec(); err != nil {
+			t.Fatalf("instruction %d: %v", i+1, err)
+		}
+	}
+}
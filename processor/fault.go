@@ -0,0 +1,101 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/uroshercog/sic-machine/memory"
+)
+
+// FaultKind ...
+type FaultKind int
+
+const (
+	// FaultInvalidAddress is an access outside of the memory
+	FaultInvalidAddress FaultKind = iota
+	// FaultProtection is an access to a block with a different storage key
+	FaultProtection
+	// FaultInvalidOpcode is an instruction that could not be decoded
+	FaultInvalidOpcode
+	// FaultInvalidAddressing is an invalid combination of the n, i, x, b and p bits
+	FaultInvalidAddressing
+	// FaultPrivilegedInstruction is a privileged instruction executed in user mode
+	FaultPrivilegedInstruction
+	// FaultDevice is an error reported by a device
+	FaultDevice
+	// FaultDivisionByZero is a DIV, DIVR or DIVF with a zero divisor
+	FaultDivisionByZero
+	// FaultOverflow is a FIX of a value that does not fit into 24 bits
+	FaultOverflow
+)
+
+var (
+	faultNames = []string{"Invalid address", "Protection violation", "Invalid opcode",
+		"Invalid addressing", "Privileged instruction", "Device error", "Division by zero", "Arithmetic overflow"}
+
+	// Program interrupt codes of the faults that can be handled by the guest
+	faultICodes = map[FaultKind]byte{
+		FaultInvalidAddress:        ICodeAddressOutOfRange,
+		FaultProtection:            ICodeProtectionViolation,
+		FaultInvalidOpcode:         ICodeIllegalInstruction,
+		FaultInvalidAddressing:     ICodeIllegalInstruction,
+		FaultPrivilegedInstruction: ICodePrivilegedInstuction,
+		FaultDivisionByZero:        ICodeArithmeticOverflow,
+		FaultOverflow:              ICodeArithmeticOverflow,
+	}
+)
+
+func (k FaultKind) String() string {
+	if int(k) < len(faultNames) {
+		return faultNames[k]
+	}
+	return fmt.Sprintf("Fault %d", int(k))
+}
+
+// Fault describes an instruction the CPU could not execute
+type Fault struct {
+	Kind FaultKind
+	// Address of the faulting instruction
+	PC int32
+	// Bytes of the instruction fetched before the fault
+	Instruction []byte
+	// Effective address of the instruction, -1 if it was not resolved
+	Address int32
+	Err     error
+}
+
+func (f *Fault) Error() string {
+	msg := fmt.Sprintf("%s at %#06x [% x]", f.Kind, f.PC, f.Instruction)
+	if f.Address >= 0 {
+		msg += fmt.Sprintf(" address %#06x", f.Address)
+	}
+	if f.Err != nil {
+		msg += ": " + f.Err.Error()
+	}
+	return msg
+}
+
+// Aborts the current instruction with a fault
+func (cpu *CPU) fault(kind FaultKind, msg string) {
+	panic(&Fault{Kind: kind, Err: errors.New(msg)})
+}
+
+// Converts the panic value of an aborted instruction to a fault
+func (cpu *CPU) toFault(r interface{}, pc int32) *Fault {
+	var fault *Fault
+	switch err := r.(type) {
+	case *Fault:
+		fault = err
+	case *memory.AddressError:
+		fault = &Fault{Kind: FaultInvalidAddress, Err: err}
+	case *memory.ProtectionError:
+		fault = &Fault{Kind: FaultProtection, Err: err}
+	default:
+		panic(r)
+	}
+
+	fault.PC = pc
+	fault.Instruction = append([]byte(nil), cpu.fetched...)
+	fault.Address = cpu.address
+	return fault
+}
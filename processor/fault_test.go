@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"testing"
+
+	reg "github.com/uroshercog/sic-machine/processor/registers"
+)
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		// Status word the program runs with, supervisor mode with all interrupts masked by default
+		sw   int32
+		kind FaultKind
+	}{
+		{"invalid address", "+LDA 61439", 0x800000, FaultInvalidAddress},
+		{"protection", "LDA 2048", 0x000000, FaultProtection},
+		{"invalid opcode", "BYTE X'FF0000'", 0x800000, FaultInvalidOpcode},
+		{"privileged", "STI #10", 0x000000, FaultPrivilegedInstruction},
+		{"division by zero", "DIV #0", 0x800000, FaultDivisionByZero},
+		{"device", "RD #66", 0x800000, FaultDevice},
+		// F becomes 1e9
+		{"overflow", "FLOAT\n        MULF BIG\n        FIX", 0x800000, FaultOverflow},
+	}
+
+	for _, test := range tests {
+		cpu, _ := newTestCPU(t, "PROG    START   0\n        LDA #1\n        "+test.src+"\nBIG     BYTE X'41EEE6B28000'\n        END PROG\n")
+		cpu.SetRegister(RegSW, test.sw)
+		// The block after the program belongs to another process
+		cpu.ram.SetKey(2048, 1)
+
+		var err error
+		for i := 0; i < 4 && err == nil; i++ {
+			err = cpu.Exec()
+		}
+		fault, ok := err.(*Fault)
+		if !ok {
+			t.Errorf("%s: error %v, want a fault", test.name, err)
+			continue
+		}
+		if fault.Kind != test.kind {
+			t.Errorf("%s: %v, want %s", test.name, fault, test.kind)
+		}
+		// The CPU stops at the faulting instruction
+		if pc := cpu.GetRegister(RegPC); pc != fault.PC || len(fault.Instruction) == 0 {
+			t.Errorf("%s: PC %06X, fault at %06X with instruction % x", test.name, pc, fault.PC, fault.Instruction)
+		}
+	}
+}
+
+func TestFaultAddress(t *testing.T) {
+	cpu, _ := newTestCPU(t, "PROG    START   0\n        +LDA    61439\n        END     PROG\n")
+	err := cpu.Exec()
+	fault, ok := err.(*Fault)
+	if !ok || fault.Address != 61439 || fault.PC != 0 {
+		t.Fatalf("error %v, want an invalid address at 0x00EFFF", err)
+	}
+	if want := []byte{0x03, 0x10, 0xEF, 0xFF}; string(fault.Instruction) != string(want) {
+		t.Errorf("instruction % x, want % x", fault.Instruction, want)
+	}
+}
+
+func TestFaultInterrupt(t *testing.T) {
+	cpu, program := newTestCPU(t, `PROG    START   0
+        DIV     #0
+HALT    J       HALT
+HANDLER J       HANDLER
+        END     PROG
+`)
+	handler := program.Symbols["HANDLER"]
+	cpu.ram.SetWord(workAreas[IntProgram]+waNewSW, 0x800000)
+	cpu.ram.SetWord(workAreas[IntProgram]+waNewPC, handler)
+	cpu.SetRegister(RegSW, 0x80F000)
+
+	// With program interrupts enabled the guest handles the fault
+	if err := cpu.Exec(); err != nil {
+		t.Fatalf("fault %v, want a program interrupt", err)
+	}
+	if pc := cpu.GetRegister(RegPC); pc != handler {
+		t.Errorf("PC %06X, want the handler at %06X", pc, handler)
+	}
+	old := &reg.SwRegister{}
+	old.Set(cpu.ram.GetWord(workAreas[IntProgram] + waOldSW))
+	if old.GetICode() != ICodeArithmeticOverflow {
+		t.Errorf("ICODE %d, want %d", old.GetICode(), ICodeArithmeticOverflow)
+	}
+}
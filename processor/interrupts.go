@@ -0,0 +1,117 @@
+package processor
+
+import (
+	reg "github.com/uroshercog/sic-machine/processor/registers"
+)
+
+// Interrupt classes, in order of priority
+const (
+	IntSVC     = iota // Class I, supervisor call
+	IntProgram        // Class II, program error
+	IntTimer          // Class III, interval timer expired
+	IntIO             // Class IV, I/O channel finished
+)
+
+// Program interrupt codes, stored in ICODE of the saved status word
+const (
+	ICodeIllegalInstruction   = 0x00
+	ICodePrivilegedInstuction = 0x01
+	ICodeAddressOutOfRange    = 0x02
+	ICodeProtectionViolation  = 0x03
+	ICodeArithmeticOverflow   = 0x04
+)
+
+var (
+	// Start addresses of the interrupt work areas, indexed by class
+	workAreas = [...]int32{0x100, 0x130, 0x160, 0x190}
+)
+
+// Offsets inside of an interrupt work area
+const (
+	waNewSW     = 0x00
+	waNewPC     = 0x03
+	waOldSW     = 0x06
+	waOldPC     = 0x09
+	waRegisters = 0x0C
+)
+
+// Interrupt raises an interrupt of the given class. It is serviced after
+// the current instruction, as soon as the class is not masked in SW.
+func (cpu *CPU) Interrupt(class int, code byte) {
+	cpu.pending[class] = append(cpu.pending[class], code)
+}
+
+// Services the highest priority pending interrupt that is not masked
+func (cpu *CPU) handleInterrupts() {
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+
+	for class, codes := range cpu.pending {
+		if len(codes) == 0 {
+			continue
+		}
+
+		// Supervisor calls cannot be masked
+		if class != IntSVC && !sw.IsEnabled(uint(class)) {
+			continue
+		}
+
+		cpu.pending[class] = codes[1:]
+		cpu.enterInterrupt(class, codes[0])
+		return
+	}
+}
+
+// Saves the context into the work area of the class and loads the new SW and PC from it
+func (cpu *CPU) enterInterrupt(class int, code byte) {
+	area := workAreas[class]
+
+	// The work areas are always accessed in supervisor mode
+	cpu.ram.SetAccess(true, 0)
+
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+	sw.SetICode(code)
+
+	cpu.storeStatus(area + waOldSW)
+
+	cpu.registers[RegSW].Set(cpu.ram.GetWord(area + waNewSW))
+	cpu.registers[RegPC].Set(cpu.ram.GetWord(area + waNewPC))
+}
+
+// Stores SW, PC, A, X, L, B, S, T and F starting at addr, in the layout LPS expects
+func (cpu *CPU) storeStatus(addr int32) {
+	cpu.ram.SetWord(addr, cpu.registers[RegSW].Get())
+	cpu.ram.SetWord(addr+3, cpu.registers[RegPC].Get())
+
+	addr += 6
+	for _, r := range []int{RegA, RegX, RegL, RegB, RegS, RegT} {
+		cpu.ram.SetWord(addr, cpu.registers[r].Get())
+		addr += 3
+	}
+	cpu.ram.SetFloat(addr, cpu.registers[RegF].(*reg.FloatRegister).GetBits())
+}
+
+// Loads SW, PC, A, X, L, B, S, T and F starting at addr
+func (cpu *CPU) loadStatus(addr int32) {
+	sw := cpu.ram.GetWord(addr)
+	pc := cpu.ram.GetWord(addr + 3)
+
+	addr += 6
+	for _, r := range []int{RegA, RegX, RegL, RegB, RegS, RegT} {
+		cpu.registers[r].Set(cpu.ram.GetWord(addr))
+		addr += 3
+	}
+	cpu.registers[RegF].(*reg.FloatRegister).SetBits(cpu.ram.GetFloat(addr))
+
+	cpu.registers[RegSW].Set(sw)
+	cpu.registers[RegPC].Set(pc)
+}
+
+// Decrements the interval timer and raises a timer interrupt when it runs out
+func (cpu *CPU) tickTimer() {
+	if cpu.timer > 0 {
+		cpu.timer--
+		if cpu.timer == 0 {
+			cpu.Interrupt(IntTimer, 0)
+		}
+	}
+}
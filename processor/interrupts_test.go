@@ -0,0 +1,95 @@
+package processor
+
+import (
+	"testing"
+
+	reg "github.com/uroshercog/sic-machine/processor/registers"
+)
+
+// Sets the new SW and PC in the work area of the class
+func setHandler(cpu *CPU, class int, sw, pc int32) {
+	cpu.ram.SetWord(workAreas[class]+waNewSW, sw)
+	cpu.ram.SetWord(workAreas[class]+waNewPC, pc)
+}
+
+func TestSupervisorCall(t *testing.T) {
+	cpu, program := newTestCPU(t, `PROG    START   0
+        LDA     #5
+        SVC     3
+HALT    J       HALT
+HANDLER LDA     #7
+        LPS     262
+        END     PROG
+`)
+	handler := program.Symbols["HANDLER"]
+	setHandler(cpu, IntSVC, 0x800000, handler)
+
+	execute(t, cpu, 2)
+	if pc := cpu.GetRegister(RegPC); pc != handler {
+		t.Fatalf("PC %06X after SVC, want the handler at %06X", pc, handler)
+	}
+
+	// The old status is saved for LPS to return to
+	area := workAreas[IntSVC]
+	if code := byte(cpu.ram.GetWord(area+waOldSW) & 0xFF); code != 3 {
+		t.Errorf("saved ICODE %d, want 3", code)
+	}
+	if pc := cpu.ram.GetWord(area + waOldPC); pc != program.Symbols["HALT"] {
+		t.Errorf("saved PC %06X, want %06X", pc, program.Symbols["HALT"])
+	}
+	if a := cpu.ram.GetWord(area + waRegisters); a != 5 {
+		t.Errorf("saved A %d, want 5", a)
+	}
+
+	execute(t, cpu, 2)
+	if pc, a := cpu.GetRegister(RegPC), cpu.GetRegister(RegA); pc != program.Symbols["HALT"] || a != 5 {
+		t.Errorf("PC %06X and A %d after LPS, want %06X and 5", pc, a, program.Symbols["HALT"])
+	}
+}
+
+func TestMaskedInterrupt(t *testing.T) {
+	cpu, program := newTestCPU(t, `PROG    START   0
+        STI     #2
+LOOP    J       LOOP
+HANDLER J       HANDLER
+        END     PROG
+`)
+	handler := program.Symbols["HANDLER"]
+	setHandler(cpu, IntTimer, 0x800000, handler)
+
+	// The timer runs out, but its class is masked
+	execute(t, cpu, 5)
+	if pc := cpu.GetRegister(RegPC); pc != program.Symbols["LOOP"] {
+		t.Fatalf("PC %06X with the timer masked, want %06X", pc, program.Symbols["LOOP"])
+	}
+
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+	sw.Set(sw.Get() | 0x8000>>IntTimer)
+	execute(t, cpu, 1)
+	if pc := cpu.GetRegister(RegPC); pc != handler {
+		t.Errorf("PC %06X after unmasking, want the handler at %06X", pc, handler)
+	}
+}
+
+func TestInterruptPriority(t *testing.T) {
+	cpu, program := newTestCPU(t, `PROG    START   0
+        J       PROG
+IO      J       IO
+PROGRAM J       PROGRAM
+        END     PROG
+`)
+	setHandler(cpu, IntIO, 0x800000, program.Symbols["IO"])
+	setHandler(cpu, IntProgram, 0x800000, program.Symbols["PROGRAM"])
+	cpu.SetRegister(RegSW, 0x80F000)
+
+	// A program interrupt has a higher priority, the I/O one stays pending
+	cpu.Interrupt(IntIO, 1)
+	cpu.Interrupt(IntProgram, ICodeArithmeticOverflow)
+	execute(t, cpu, 1)
+	if pc := cpu.GetRegister(RegPC); pc != program.Symbols["PROGRAM"] {
+		t.Errorf("PC %06X, want the program interrupt handler at %06X", pc, program.Symbols["PROGRAM"])
+	}
+	if len(cpu.pending[IntIO]) != 1 {
+		t.Errorf("pending I/O interrupts %v, want one", cpu.pending[IntIO])
+	}
+}
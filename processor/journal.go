@@ -0,0 +1,239 @@
+package processor
+
+import (
+	"errors"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/disasm"
+	"github.com/uroshercog/sic-machine/memory"
+	reg "github.com/uroshercog/sic-machine/processor/registers"
+)
+
+// Byte overwritten by an instruction
+type overwrite struct {
+	addr int32
+	old  byte
+}
+
+// Byte an instruction read from a device
+type deviceRead struct {
+	fd    byte
+	value byte
+}
+
+// How to undo a single tick of the CPU
+type undo struct {
+	registers [9]int32
+	float     uint64
+	timer     int32
+	pending   [4][]byte
+	keys      [memory.MaxAddress / memory.BlockSize]byte
+	channels  []dev.ChannelState
+	writes    []overwrite
+	reads     []deviceRead
+	// Instruction executed in the tick, nil if the CPU was idle or it faulted
+	inst *disasm.Instruction
+}
+
+// Journal keeps the undo records of the last executed instructions in a ring
+// buffer. Bytes written and the progress made by the channels in the same tick
+// are undone with the instruction.
+type Journal struct {
+	entries []*undo
+	// Index of the oldest entry and the number of entries
+	first int
+	count int
+}
+
+// NewJournal creates a journal of the last size instructions
+func NewJournal(size int) *Journal {
+	return &Journal{entries: make([]*undo, size)}
+}
+
+// Len returns the number of instructions that can be undone
+func (j *Journal) Len() int {
+	return j.count
+}
+
+func (j *Journal) push(u *undo) {
+	if len(j.entries) == 0 {
+		return
+	}
+
+	if j.count == len(j.entries) {
+		// The oldest entry is overwritten
+		j.entries[j.first] = u
+		j.first = (j.first + 1) % len(j.entries)
+		return
+	}
+	j.entries[(j.first+j.count)%len(j.entries)] = u
+	j.count++
+}
+
+func (j *Journal) pop() *undo {
+	if j.count == 0 {
+		return nil
+	}
+	j.count--
+	i := (j.first + j.count) % len(j.entries)
+	u := j.entries[i]
+	j.entries[i] = nil
+	return u
+}
+
+// SetJournalSize records the last size instructions so they can be undone,
+// 0 turns the journal off
+func (cpu *CPU) SetJournalSize(size int) {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	if size <= 0 {
+		cpu.journal = nil
+		return
+	}
+	cpu.journal = NewJournal(size)
+}
+
+// JournalLength returns the number of instructions that can be undone
+func (cpu *CPU) JournalLength() int {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	if cpu.journal == nil {
+		return 0
+	}
+	return cpu.journal.Len()
+}
+
+// Starts recording how to undo the tick that follows
+func (cpu *CPU) beginUndo() {
+	if cpu.journal == nil {
+		return
+	}
+
+	u := &undo{
+		float:    cpu.registers[RegF].(*reg.FloatRegister).GetBits(),
+		timer:    cpu.timer,
+		channels: cpu.channels.SaveState(),
+	}
+	for i, r := range cpu.registers {
+		if i != RegF {
+			u.registers[i] = r.Get()
+		}
+	}
+	for class, codes := range cpu.pending {
+		u.pending[class] = append([]byte(nil), codes...)
+	}
+	for i := range u.keys {
+		u.keys[i] = cpu.ram.GetKey(int32(i * memory.BlockSize))
+	}
+	cpu.recording = u
+}
+
+func (cpu *CPU) endUndo() {
+	if cpu.recording != nil {
+		cpu.journal.push(cpu.recording)
+		cpu.recording = nil
+	}
+}
+
+// StepBack undoes the last executed instruction
+func (cpu *CPU) StepBack() error {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	if cpu.running {
+		return errors.New("CPU is running")
+	}
+	if cpu.journal == nil {
+		return errors.New("Journal is off")
+	}
+
+	u := cpu.journal.pop()
+	if u == nil {
+		return errors.New("Nothing to undo")
+	}
+	cpu.applyUndo(u)
+	return nil
+}
+
+// ReverseContinue undoes instructions until an execute breakpoint or a
+// watchpoint is reached, or the journal runs out. Hit counts are not changed.
+func (cpu *CPU) ReverseContinue() (*StopReason, error) {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	if cpu.running {
+		return nil, errors.New("CPU is running")
+	}
+	if cpu.journal == nil {
+		return nil, errors.New("Journal is off")
+	}
+	if cpu.journal.Len() == 0 {
+		return nil, errors.New("Nothing to undo")
+	}
+
+	for {
+		u := cpu.journal.pop()
+		if u == nil {
+			// Reached the oldest recorded instruction
+			return &StopReason{Kind: StopPause}, nil
+		}
+		cpu.applyUndo(u)
+
+		// The undone instruction wrote to a watched address
+		for _, w := range u.writes {
+			bp := cpu.Breakpoints.find(func(bp *Breakpoint) bool {
+				return (bp.Kind == BreakWrite || bp.Kind == BreakAccess) && bp.contains(w.addr)
+			})
+			if bp != nil {
+				return &StopReason{Kind: StopBreakpoint, Breakpoint: bp, Address: w.addr}, nil
+			}
+		}
+
+		pc := cpu.registers[RegPC].Get()
+		bp := cpu.Breakpoints.find(func(bp *Breakpoint) bool {
+			return bp.Kind == BreakExecute && bp.Address == pc && (bp.Condition == nil || bp.Condition.Evaluate(cpu))
+		})
+		if bp != nil {
+			return &StopReason{Kind: StopBreakpoint, Breakpoint: bp, Address: pc}, nil
+		}
+	}
+}
+
+func (cpu *CPU) applyUndo(u *undo) {
+	cells := cpu.ram.GetRaw()
+	for i := len(u.writes) - 1; i >= 0; i-- {
+		cells[u.writes[i].addr] = u.writes[i].old
+	}
+
+	// The device reads the same bytes again when the instruction is re-executed
+	for i := len(u.reads) - 1; i >= 0; i-- {
+		cpu.devices.Unread(u.reads[i].fd, u.reads[i].value)
+	}
+
+	for i, key := range u.keys {
+		cpu.ram.SetKey(int32(i*memory.BlockSize), key)
+	}
+
+	for i, r := range cpu.registers {
+		if i != RegF {
+			r.Set(u.registers[i])
+		}
+	}
+	cpu.registers[RegF].(*reg.FloatRegister).SetBits(u.float)
+	cpu.timer = u.timer
+	cpu.pending = u.pending
+	if err := cpu.channels.LoadState(u.channels); err != nil {
+		panic(err)
+	}
+
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+	cpu.ram.SetAccess(sw.IsSupervisor(), sw.GetID())
+
+	if u.inst != nil {
+		for _, f := range cpu.OnStepBack {
+			f(u.inst)
+		}
+	}
+}
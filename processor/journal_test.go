@@ -0,0 +1,215 @@
+package processor
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/disasm"
+)
+
+// Device that counts the bytes read from it
+type counterDevice struct {
+	n byte
+}
+
+func (cd *counterDevice) Read() (byte, error) {
+	cd.n++
+	return cd.n, nil
+}
+
+func (cd *counterDevice) Write(value byte) error {
+	return nil
+}
+
+func (cd *counterDevice) Test() bool {
+	return true
+}
+
+func TestStepBack(t *testing.T) {
+	cpu, program := newTestCPU(t, `PROG    START   0
+        LDA     #5
+        STA     VALUE
+        ADD     #2
+        STA     VALUE
+HALT    J       HALT
+VALUE   WORD    9
+        END     PROG
+`)
+	value := program.Symbols["VALUE"]
+
+	if err := cpu.StepBack(); err == nil || err.Error() != "Journal is off" {
+		t.Errorf("error %v without a journal", err)
+	}
+	cpu.SetJournalSize(10)
+	if err := cpu.StepBack(); err == nil || err.Error() != "Nothing to undo" {
+		t.Errorf("error %v before the first instruction", err)
+	}
+
+	execute(t, cpu, 4)
+	if cpu.JournalLength() != 4 {
+		t.Errorf("journal of %d instructions, want 4", cpu.JournalLength())
+	}
+
+	var undone []string
+	cpu.OnStepBack = append(cpu.OnStepBack, func(inst *disasm.Instruction) {
+		undone = append(undone, inst.Mnemonic)
+	})
+
+	want := []struct {
+		pc, a, value int32
+	}{
+		{9, 7, 5},
+		{6, 5, 5},
+		{3, 5, 9},
+		{0, 0, 9},
+	}
+	for i, w := range want {
+		if err := cpu.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+		if pc, a, v := cpu.GetRegister(RegPC), cpu.GetRegister(RegA), cpu.ram.GetWord(value); pc != w.pc || a != w.a || v != w.value {
+			t.Errorf("undo %d: PC %d, A %d, VALUE %d, want %d, %d, %d", i+1, pc, a, v, w.pc, w.a, w.value)
+		}
+	}
+	if got := fmt.Sprint(undone); got != "[STA ADD STA LDA]" {
+		t.Errorf("undone %s", got)
+	}
+
+	// The program runs the same way again
+	execute(t, cpu, 4)
+	if v := cpu.ram.GetWord(value); v != 7 {
+		t.Errorf("VALUE %d after re-executing, want 7", v)
+	}
+}
+
+func TestJournalRing(t *testing.T) {
+	cpu, _ := newTestCPU(t, `PROG    START   0
+LOOP    LDA     #1
+        ADD     #1
+        J       LOOP
+        END     PROG
+`)
+	cpu.SetJournalSize(2)
+	execute(t, cpu, 4)
+	if cpu.JournalLength() != 2 {
+		t.Fatalf("journal of %d instructions, want 2", cpu.JournalLength())
+	}
+
+	// Only the last two instructions are kept
+	cpu.StepBack()
+	cpu.StepBack()
+	if pc := cpu.GetRegister(RegPC); pc != 6 {
+		t.Errorf("PC %d after undoing the last two, want 6", pc)
+	}
+	if err := cpu.StepBack(); err == nil {
+		t.Error("undid an instruction that was overwritten")
+	}
+}
+
+func TestStepBackDeviceRead(t *testing.T) {
+	cpu, _ := newTestCPU(t, `PROG    START   0
+        RD      #5
+        RD      #5
+        END     PROG
+`)
+	cpu.devices.Set(5, &counterDevice{})
+	cpu.SetJournalSize(10)
+
+	execute(t, cpu, 2)
+	cpu.StepBack()
+	cpu.StepBack()
+	if a := cpu.GetRegister(RegA); a != 0 {
+		t.Errorf("A %d after undoing the reads", a)
+	}
+
+	// The undone reads return the same bytes again
+	execute(t, cpu, 1)
+	if a := cpu.GetRegister(RegA); a != 1 {
+		t.Errorf("read %d again, want 1", a)
+	}
+	execute(t, cpu, 1)
+	if a := cpu.GetRegister(RegA); a != 2 {
+		t.Errorf("read %d again, want 2", a)
+	}
+}
+
+const channelSource = `PROG    START   0
+        LDA     #1
+        LDS     #CMD
+        SIO
+LOOP    J       LOOP
+CMD     BYTE    X'010500000004'
+        WORD    BUF
+        BYTE    X'000000000000000000'
+BUF     RESB    4
+        END     PROG
+`
+
+func TestStepBackChannel(t *testing.T) {
+	cpu, program := newTestCPU(t, channelSource)
+	cpu.devices.Set(5, &counterDevice{})
+	cpu.SetJournalSize(10)
+	buf := program.Symbols["BUF"]
+	cells := cpu.ram.GetRaw()
+
+	// The channel transfers in the same tick as SIO
+	execute(t, cpu, 3)
+	if !bytes.Equal(cells[buf:buf+4], []byte{1, 2, 3, 4}) {
+		t.Fatalf("buffer % X after SIO", cells[buf:buf+4])
+	}
+
+	cpu.StepBack()
+	if !bytes.Equal(cells[buf:buf+4], []byte{0, 0, 0, 0}) {
+		t.Errorf("buffer % X after undoing SIO", cells[buf:buf+4])
+	}
+	if status := cpu.channels.Status(1); status != dev.ChannelIdle {
+		t.Errorf("channel %v after undoing SIO, want idle", status)
+	}
+
+	execute(t, cpu, 1)
+	if !bytes.Equal(cells[buf:buf+4], []byte{1, 2, 3, 4}) {
+		t.Errorf("buffer % X after re-executing SIO", cells[buf:buf+4])
+	}
+}
+
+func TestReverseContinue(t *testing.T) {
+	cpu, program := newTestCPU(t, channelSource)
+	cpu.devices.Set(5, &counterDevice{})
+	buf := program.Symbols["BUF"]
+
+	if _, err := cpu.ReverseContinue(); err == nil || err.Error() != "Journal is off" {
+		t.Errorf("error %v without a journal", err)
+	}
+	cpu.SetJournalSize(10)
+	execute(t, cpu, 6)
+
+	// The channel write is undone with SIO
+	cpu.Breakpoints.Add(&Breakpoint{Kind: BreakWrite, Address: buf + 2})
+	reason, err := cpu.ReverseContinue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reason.Kind != StopBreakpoint || reason.Address != buf+2 {
+		t.Errorf("stopped on %s", reason)
+	}
+	if pc := cpu.GetRegister(RegPC); pc != 6 {
+		t.Errorf("PC %d, want SIO at 6", pc)
+	}
+
+	cpu.Breakpoints.Clear()
+	cpu.Breakpoints.Add(&Breakpoint{Kind: BreakExecute, Address: 3})
+	if reason, _ = cpu.ReverseContinue(); reason.Kind != StopBreakpoint || cpu.GetRegister(RegPC) != 3 {
+		t.Errorf("stopped on %s at %d, want the breakpoint at 3", reason, cpu.GetRegister(RegPC))
+	}
+
+	// Without breakpoints it stops at the oldest instruction
+	cpu.Breakpoints.Clear()
+	if reason, _ = cpu.ReverseContinue(); reason.Kind != StopPause || cpu.GetRegister(RegPC) != 0 {
+		t.Errorf("stopped on %s at %d, want the start", reason, cpu.GetRegister(RegPC))
+	}
+	if _, err := cpu.ReverseContinue(); err == nil || err.Error() != "Nothing to undo" {
+		t.Errorf("error %v with an empty journal", err)
+	}
+}
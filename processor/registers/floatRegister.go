@@ -1,17 +1,152 @@
 package registers
 
-// FloatRegister ...
+import "math"
+
+const (
+	floatExpBias  = 1024
+	floatExpMax   = 0x7FF
+	floatFracBits = 36
+	floatFracMask = uint64(1)<<floatFracBits - 1
+	floatSignBit  = uint64(1) << 47
+)
+
+// FloatRegister holds a SIC/XE 48-bit floating point value.
+// Every value stored in the register is rounded to what the 48-bit
+// format (1 sign bit, 11-bit exponent, 36-bit fraction) can represent.
 type FloatRegister struct {
-	IntRegister
+	value float64
+}
+
+// GetFloat ...
+func (f *FloatRegister) GetFloat() float64 {
+	return f.value
+}
+
+// SetFloat ...
+func (f *FloatRegister) SetFloat(v float64) {
+	f.value = DecodeFloat(EncodeFloat(v))
+}
+
+// GetBits returns the register in the 48-bit memory representation
+func (f *FloatRegister) GetBits() uint64 {
+	return EncodeFloat(f.value)
+}
+
+// SetBits loads the register from the 48-bit memory representation
+func (f *FloatRegister) SetBits(bits uint64) {
+	f.value = DecodeFloat(bits)
 }
 
-func (f *FloatRegister) GetFloat() float32 {
-	// Format the float properly
-	return float32(f.value)
+// Normalize rounds the value to the 48-bit format. The register keeps the
+// value and not its bits, so unnormalized operands of LDF are normalized by
+// SetBits already and GetBits always returns a normalized fraction.
+func (f *FloatRegister) Normalize() {
+	f.SetFloat(f.value)
+}
+
+// Get returns the integer part of the value
+func (f *FloatRegister) Get() int32 {
+	return int32(f.value)
+}
+
+// Set ...
+func (f *FloatRegister) Set(value int32) {
+	f.SetFloat(float64(value))
+}
 
+// Add ...
+func (f *FloatRegister) Add(value int32) {
+	f.SetFloat(f.value + float64(value))
 }
 
-func (f *FloatRegister) SetFloat(v float32) {
-	// Format the float properly
-	f.value = int32(v)
+// Sub ...
+func (f *FloatRegister) Sub(value int32) {
+	f.SetFloat(f.value - float64(value))
+}
+
+// Clear ...
+func (f *FloatRegister) Clear() {
+	f.value = 0
+}
+
+// Multiply ...
+func (f *FloatRegister) Multiply(value int32) {
+	f.SetFloat(f.value * float64(value))
+}
+
+// Divide ...
+func (f *FloatRegister) Divide(value int32) {
+	f.SetFloat(f.value / float64(value))
+}
+
+// ShiftLeft ...
+func (f *FloatRegister) ShiftLeft(bitCount uint32) {
+	f.SetFloat(math.Ldexp(f.value, int(bitCount)))
+}
+
+// ShiftRight ...
+func (f *FloatRegister) ShiftRight(bitCount uint32) {
+	f.SetFloat(math.Ldexp(f.value, -int(bitCount)))
+}
+
+// And ...
+func (f *FloatRegister) And(value int32) {
+	f.SetBits(f.GetBits() & uint64(uint32(value)))
+}
+
+// Or ...
+func (f *FloatRegister) Or(value int32) {
+	f.SetBits(f.GetBits() | uint64(uint32(value)))
+}
+
+// EncodeFloat converts v to the SIC/XE 48-bit floating point format.
+// The fraction is normalized so that its highest bit is set, values too
+// large to be represented saturate and values too small become zero.
+func EncodeFloat(v float64) uint64 {
+	if v == 0 || math.IsNaN(v) {
+		return 0
+	}
+
+	var sign uint64
+	if v < 0 {
+		sign = floatSignBit
+		v = -v
+	}
+
+	if math.IsInf(v, 0) {
+		return sign | floatExpMax<<floatFracBits | floatFracMask
+	}
+
+	// v = frac * 2^exp, where frac is in [0.5, 1)
+	frac, exp := math.Frexp(v)
+	bits := uint64(math.Floor(math.Ldexp(frac, floatFracBits) + 0.5))
+	if bits > floatFracMask {
+		// Rounding carried into the next bit
+		bits >>= 1
+		exp++
+	}
+
+	exp += floatExpBias
+	if exp < 0 {
+		return 0
+	} else if exp > floatExpMax {
+		return sign | floatExpMax<<floatFracBits | floatFracMask
+	}
+
+	return sign | uint64(exp)<<floatFracBits | bits
+}
+
+// DecodeFloat converts the SIC/XE 48-bit floating point format to a float64
+func DecodeFloat(bits uint64) float64 {
+	frac := bits & floatFracMask
+	if frac == 0 {
+		return 0
+	}
+
+	exp := int((bits >> floatFracBits) & floatExpMax)
+	v := math.Ldexp(float64(frac), exp-floatExpBias-floatFracBits)
+	if bits&floatSignBit != 0 {
+		return -v
+	}
+	return v
 }
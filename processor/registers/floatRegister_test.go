@@ -0,0 +1,81 @@
+package registers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeFloat(t *testing.T) {
+	tests := []struct {
+		value float64
+		bits  uint64
+	}{
+		{0, 0},
+		{1, 0x401800000000},
+		{0.5, 0x400800000000},
+		{3, 0x402C00000000},
+		{-2, 0xC02800000000},
+		{0.1, 0x3FDCCCCCCCCD},
+		{math.NaN(), 0},
+		{math.Inf(1), 0x7FFFFFFFFFFF},
+		{math.Inf(-1), 0xFFFFFFFFFFFF},
+		// Too large and too small for the 11-bit exponent
+		{math.Ldexp(1, 1100), 0x7FFFFFFFFFFF},
+		{math.Ldexp(1, -1100), 0},
+		// Rounding carries into the exponent
+		{1 - math.Ldexp(1, -40), 0x401800000000},
+	}
+
+	for _, test := range tests {
+		if got := EncodeFloat(test.value); got != test.bits {
+			t.Errorf("EncodeFloat(%v) = %#012x, want %#012x", test.value, got, test.bits)
+		}
+	}
+}
+
+func TestDecodeFloat(t *testing.T) {
+	tests := []struct {
+		bits  uint64
+		value float64
+	}{
+		{0, 0},
+		{0x401800000000, 1},
+		{0xC02800000000, -2},
+		{0x402C00000000, 3},
+		// A zero fraction is zero whatever the exponent
+		{0x7FF000000000, 0},
+	}
+
+	for _, test := range tests {
+		if got := DecodeFloat(test.bits); got != test.value {
+			t.Errorf("DecodeFloat(%#012x) = %v, want %v", test.bits, got, test.value)
+		}
+	}
+}
+
+func TestFloatRoundTrip(t *testing.T) {
+	values := []float64{1, -1, 0.1, 123456.789, -1e-300, 1e300, math.Pi, 1.0 / 3}
+	for _, v := range values {
+		got := DecodeFloat(EncodeFloat(v))
+		if math.Abs(got-v) > math.Abs(v)*math.Ldexp(1, -36) {
+			t.Errorf("%v decoded as %v", v, got)
+		}
+		if again := DecodeFloat(EncodeFloat(got)); again != got {
+			t.Errorf("%v is not stable, %v then %v", v, got, again)
+		}
+	}
+}
+
+func TestFloatRegister(t *testing.T) {
+	var f FloatRegister
+	f.Set(7)
+	f.Divide(2)
+	if f.GetFloat() != 3.5 || f.Get() != 3 {
+		t.Errorf("7/2 = %v, integer part %d", f.GetFloat(), f.Get())
+	}
+
+	f.SetBits(0x402C00000000)
+	if f.GetFloat() != 3 || f.GetBits() != 0x402C00000000 {
+		t.Errorf("bits %#012x read as %v", f.GetBits(), f.GetFloat())
+	}
+}
@@ -1,10 +1,25 @@
 package registers
 
-// IntRegister ...
+const (
+	wordMask = 0xFFFFFF
+	wordSign = 0x800000
+	wordBits = 24
+)
+
+// IntRegister holds a 24-bit word, sign extended to an int32
 type IntRegister struct {
 	value int32
 }
 
+// ToWord wraps value to 24 bits and sign extends it
+func ToWord(value int32) int32 {
+	value &= wordMask
+	if value&wordSign != 0 {
+		value -= 1 << wordBits
+	}
+	return value
+}
+
 // Get ...
 func (reg *IntRegister) Get() int32 {
 	return reg.value
@@ -12,17 +27,17 @@ func (reg *IntRegister) Get() int32 {
 
 // Set ...
 func (reg *IntRegister) Set(value int32) {
-	reg.value = value
+	reg.value = ToWord(value)
 }
 
 // Add ...
 func (reg *IntRegister) Add(value int32) {
-	reg.value += value
+	reg.Set(reg.value + value)
 }
 
 // Sub ...
 func (reg *IntRegister) Sub(value int32) {
-	reg.value -= value
+	reg.Set(reg.value - value)
 }
 
 // Clear ...
@@ -32,30 +47,32 @@ func (reg *IntRegister) Clear() {
 
 // Multiply ...
 func (reg *IntRegister) Multiply(value int32) {
-	reg.value *= value
+	reg.Set(int32(int64(reg.value) * int64(value)))
 }
 
 // Divide ...
 func (reg *IntRegister) Divide(value int32) {
-	reg.value /= value
+	reg.Set(reg.value / value)
 }
 
-// ShiftLeft ...
+// ShiftLeft is a circular shift of the 24-bit word
 func (reg *IntRegister) ShiftLeft(bitCount uint32) {
-	reg.value <<= bitCount
+	bitCount %= wordBits
+	word := uint32(reg.value) & wordMask
+	reg.Set(int32(word<<bitCount | word>>(wordBits-bitCount)))
 }
 
-// ShiftRight ...
+// ShiftRight fills the vacated bits with the leftmost bit
 func (reg *IntRegister) ShiftRight(bitCount uint32) {
-	reg.value >>= bitCount
+	reg.Set(reg.value >> bitCount)
 }
 
 // And ...
 func (reg *IntRegister) And(value int32) {
-	reg.value &= value
+	reg.Set(reg.value & value)
 }
 
 // Or ...
 func (reg *IntRegister) Or(value int32) {
-	reg.value |= value
+	reg.Set(reg.value | value)
 }
@@ -1,28 +1,109 @@
 package registers
 
+// Status word layout (bit 0 is the most significant bit of the word)
+const (
+	swMode  = 0x800000 // bit 0: 1 = supervisor mode, 0 = user mode
+	swIdle  = 0x400000 // bit 1: 1 = idle, 0 = running
+	swID    = 0x3C0000 // bits 2-5: process identifier
+	swCC    = 0x030000 // bits 6-7: condition code
+	swMask  = 0x00F000 // bits 8-11: interrupt mask
+	swICode = 0x0000FF // bits 16-23: interrupt code
+
+	ccLess    = 0x000000
+	ccEqual   = 0x010000
+	ccGreater = 0x020000
+)
+
 type SwRegister struct {
 	IntRegister
 }
 
 func (sw *SwRegister) IsEqual() bool {
-	return sw.value&0x40 > 0
+	return sw.value&swCC == ccEqual
 }
 
 func (sw *SwRegister) IsLess() bool {
-	return sw.value&0x20 > 0
+	return sw.value&swCC == ccLess
 }
 
 func (sw *SwRegister) IsGreater() bool {
-	return sw.value&0x80 > 0
+	return sw.value&swCC == ccGreater
 }
 
 func (sw *SwRegister) Compare(a, b int32) {
-	sw.Clear()
 	if a < b {
-		sw.value = 0x20
+		sw.setCC(ccLess)
+	} else if a > b {
+		sw.setCC(ccGreater)
+	} else {
+		sw.setCC(ccEqual)
+	}
+}
+
+func (sw *SwRegister) CompareFloat(a, b float64) {
+	if a < b {
+		sw.setCC(ccLess)
 	} else if a > b {
-		sw.value = 0x80
+		sw.setCC(ccGreater)
+	} else {
+		sw.setCC(ccEqual)
+	}
+}
+
+// SetLess ...
+func (sw *SwRegister) SetLess() {
+	sw.setCC(ccLess)
+}
+
+// SetEqual ...
+func (sw *SwRegister) SetEqual() {
+	sw.setCC(ccEqual)
+}
+
+// SetGreater ...
+func (sw *SwRegister) SetGreater() {
+	sw.setCC(ccGreater)
+}
+
+func (sw *SwRegister) setCC(cc int32) {
+	sw.Set((sw.value &^ swCC) | cc)
+}
+
+// IsSupervisor ...
+func (sw *SwRegister) IsSupervisor() bool {
+	return sw.value&swMode != 0
+}
+
+// SetSupervisor ...
+func (sw *SwRegister) SetSupervisor(supervisor bool) {
+	if supervisor {
+		sw.Set(sw.value | swMode)
 	} else {
-		sw.value = 0x40
+		sw.Set(sw.value &^ swMode)
 	}
 }
+
+// IsIdle ...
+func (sw *SwRegister) IsIdle() bool {
+	return sw.value&swIdle != 0
+}
+
+// GetID returns the process identifier
+func (sw *SwRegister) GetID() byte {
+	return byte((sw.value & swID) >> 18)
+}
+
+// IsEnabled reports whether the mask bit for interrupt class 0-3 is set
+func (sw *SwRegister) IsEnabled(class uint) bool {
+	return sw.value&(0x8000>>class) != 0
+}
+
+// GetICode ...
+func (sw *SwRegister) GetICode() byte {
+	return byte(sw.value & swICode)
+}
+
+// SetICode ...
+func (sw *SwRegister) SetICode(code byte) {
+	sw.Set((sw.value &^ swICode) | int32(code))
+}
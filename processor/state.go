@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"errors"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	reg "github.com/uroshercog/sic-machine/processor/registers"
+)
+
+// State is everything about a CPU that is not kept in memory
+type State struct {
+	// Registers in the order of the register indices, F is kept in Float
+	Registers [9]int32
+	Float     uint64
+	Speed     int64
+	Timer     int32
+	// Codes of the pending interrupts of every class
+	Pending  [4][]byte
+	Channels []dev.ChannelState
+}
+
+// SaveState returns the state of the CPU between two instructions
+func (cpu *CPU) SaveState() *State {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	state := &State{
+		Float:    cpu.registers[RegF].(*reg.FloatRegister).GetBits(),
+		Speed:    cpu.speed,
+		Timer:    cpu.timer,
+		Channels: cpu.channels.SaveState(),
+	}
+
+	for i, r := range cpu.registers {
+		if i != RegF {
+			state.Registers[i] = r.Get()
+		}
+	}
+	for class, codes := range cpu.pending {
+		state.Pending[class] = append([]byte(nil), codes...)
+	}
+
+	return state
+}
+
+// LoadState restores a state saved by SaveState, the CPU must not be running
+func (cpu *CPU) LoadState(state *State) error {
+	cpu.mx.Lock()
+	defer cpu.mx.Unlock()
+
+	if cpu.running {
+		return errors.New("CPU is running")
+	}
+
+	if err := cpu.channels.LoadState(state.Channels); err != nil {
+		return err
+	}
+
+	for i, r := range cpu.registers {
+		if i != RegF {
+			r.Set(state.Registers[i])
+		}
+	}
+	cpu.registers[RegF].(*reg.FloatRegister).SetBits(state.Float)
+
+	for class, codes := range state.Pending {
+		cpu.pending[class] = append([]byte(nil), codes...)
+	}
+	cpu.timer = state.Timer
+	cpu.speed = state.Speed
+
+	// The journal does not lead back to the restored state
+	if cpu.journal != nil {
+		cpu.journal = NewJournal(len(cpu.journal.entries))
+	}
+
+	sw := cpu.registers[RegSW].(*reg.SwRegister)
+	cpu.ram.SetAccess(sw.IsSupervisor(), sw.GetID())
+	return nil
+}
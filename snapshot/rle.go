@@ -0,0 +1,52 @@
+package snapshot
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Memory is run-length encoded as pairs of a varint run length and the byte
+// that is repeated. Most of the memory of a program is zero.
+
+func compress(data []byte) []byte {
+	out := make([]byte, 0, 64)
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && data[i+run] == data[i] {
+			run++
+		}
+
+		n := binary.PutUvarint(buf, uint64(run))
+		out = append(out, buf[:n]...)
+		out = append(out, data[i])
+		i += run
+	}
+	return out
+}
+
+func decompress(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+
+	for len(data) > 0 {
+		run, n := binary.Uvarint(data)
+		if n <= 0 || n >= len(data) {
+			return nil, errors.New("Invalid run")
+		}
+		if uint64(len(out))+run > uint64(size) {
+			return nil, errors.New("Memory too long")
+		}
+
+		value := data[n]
+		for i := uint64(0); i < run; i++ {
+			out = append(out, value)
+		}
+		data = data[n+1:]
+	}
+
+	if len(out) != size {
+		return nil, errors.New("Memory too short")
+	}
+	return out, nil
+}
@@ -0,0 +1,205 @@
+// Package snapshot saves and restores the whole state of a machine, so that
+// a running program can be resumed later.
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Version of the format written by Write, older versions can still be read.
+// Version 2 added the state of the device manager.
+const Version = 2
+
+// Every snapshot file starts with the magic followed by the version as two bytes
+var magic = []byte("SICSNAP")
+
+// Snapshot is the state of the CPU, the memory and the devices
+type Snapshot struct {
+	CPU *processor.State
+	// Contents of the memory and the storage key of every block
+	Memory []byte
+	Keys   []byte
+	// State of the devices that implement devices.Stateful, by device number
+	Devices map[byte][]byte
+	// Input given back to the devices and their clock, empty in version 1
+	Manager []byte
+}
+
+// Encoded form of a snapshot, the memory is compressed
+type file struct {
+	CPU     *processor.State
+	Memory  []byte
+	Keys    []byte
+	Devices map[byte][]byte
+	Manager []byte
+}
+
+// Capture takes a snapshot of a machine, the CPU should be stopped
+func Capture(cpu *processor.CPU, ram *memory.RAM, devices *dev.DeviceManager) (*Snapshot, error) {
+	s := &Snapshot{
+		CPU:     cpu.SaveState(),
+		Memory:  append([]byte(nil), ram.GetRaw()...),
+		Keys:    make([]byte, memory.MaxAddress/memory.BlockSize),
+		Devices: map[byte][]byte{},
+	}
+
+	for i := range s.Keys {
+		s.Keys[i] = ram.GetKey(int32(i * memory.BlockSize))
+	}
+
+	for _, fd := range devices.Numbers() {
+		d, err := devices.Get(fd)
+		if err != nil {
+			return nil, err
+		}
+		if sd, ok := d.(dev.Stateful); ok {
+			data, err := sd.SaveState()
+			if err != nil {
+				return nil, fmt.Errorf("Device %#02x: %v", fd, err)
+			}
+			s.Devices[fd] = data
+		}
+	}
+
+	var err error
+	if s.Manager, err = devices.SaveState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Restore puts a machine in the state of the snapshot, the CPU must be stopped
+func (s *Snapshot) Restore(cpu *processor.CPU, ram *memory.RAM, devices *dev.DeviceManager) error {
+	if len(s.Memory) != memory.MaxAddress || len(s.Keys) != memory.MaxAddress/memory.BlockSize {
+		return errors.New("Snapshot of a different memory size")
+	}
+
+	// Devices are restored first, channels continue their transfers on them
+	for fd, data := range s.Devices {
+		d, err := devices.Get(fd)
+		if err != nil {
+			return err
+		}
+		sd, ok := d.(dev.Stateful)
+		if !ok {
+			return fmt.Errorf("Device %#02x cannot be restored", fd)
+		}
+		if err := sd.LoadState(data); err != nil {
+			return fmt.Errorf("Device %#02x: %v", fd, err)
+		}
+	}
+	if s.Manager != nil {
+		if err := devices.LoadState(s.Manager); err != nil {
+			return fmt.Errorf("Devices: %v", err)
+		}
+	}
+
+	copy(ram.GetRaw(), s.Memory)
+	for i, key := range s.Keys {
+		ram.SetKey(int32(i*memory.BlockSize), key)
+	}
+
+	return cpu.LoadState(s.CPU)
+}
+
+// Write writes the snapshot in the current version of the format
+func (s *Snapshot) Write(w io.Writer) error {
+	header := make([]byte, len(magic)+2)
+	copy(header, magic)
+	binary.BigEndian.PutUint16(header[len(magic):], Version)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	return gob.NewEncoder(w).Encode(&file{
+		CPU:     s.CPU,
+		Memory:  compress(s.Memory),
+		Keys:    s.Keys,
+		Devices: s.Devices,
+		Manager: s.Manager,
+	})
+}
+
+// Read reads a snapshot written by Write
+func Read(r io.Reader) (*Snapshot, error) {
+	header := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(magic)]) != string(magic) {
+		return nil, errors.New("Not a snapshot")
+	}
+	if v := binary.BigEndian.Uint16(header[len(magic):]); v > Version {
+		return nil, fmt.Errorf("Snapshot version %d is newer than %d", v, Version)
+	}
+
+	f := &file{}
+	if err := gob.NewDecoder(r).Decode(f); err != nil {
+		return nil, err
+	}
+	if f.CPU == nil {
+		return nil, errors.New("Snapshot without the CPU state")
+	}
+
+	mem, err := decompress(f.Memory, memory.MaxAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Snapshot{
+		CPU:     f.CPU,
+		Memory:  mem,
+		Keys:    f.Keys,
+		Devices: f.Devices,
+		Manager: f.Manager,
+	}, nil
+}
+
+// Save captures the machine into a file
+func Save(filename string, cpu *processor.CPU, ram *memory.RAM, devices *dev.DeviceManager) error {
+	s, err := Capture(cpu, ram, devices)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err := s.Write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load restores the machine from a file
+func Load(filename string, cpu *processor.CPU, ram *memory.RAM, devices *dev.DeviceManager) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s, err := Read(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return s.Restore(cpu, ram, devices)
+}
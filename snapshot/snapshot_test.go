@@ -0,0 +1,171 @@
+package snapshot
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uroshercog/sic-machine/asm"
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Sums the bytes read from device F0 until its input ends
+const source = `MAIN    START   0
+LOOP    TD      #240
+        JGT     DONE
+        JEQ     LOOP
+        CLEAR   A
+        RD      #240
+        ADDR    A,S
+        J       LOOP
+DONE    STS     SUM
+HALT    J       HALT
+SUM     RESW    1
+        END     MAIN
+`
+
+type machine struct {
+	cpu     *processor.CPU
+	ram     *memory.RAM
+	devices *dev.DeviceManager
+	// Address of SUM
+	sum int32
+}
+
+// Creates a machine with the program loaded and the input file on device F0
+func newMachine(t *testing.T, input string) *machine {
+	t.Helper()
+	program, err := asm.Assemble(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	program.WriteObject(&buf)
+	sections, err := obj.Parse(&buf, "sum.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &machine{ram: memory.New(), devices: dev.New(), sum: program.Symbols["SUM"]}
+	m.ram.Load(sections[0])
+	file, err := dev.NewFileDevice(input, os.O_RDONLY)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.devices.Set(0xF0, file)
+	m.cpu = processor.NewCPU(m.ram, m.devices)
+	m.cpu.SetStart(program.Entry)
+	return m
+}
+
+func (m *machine) execute(t *testing.T, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := m.cpu.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestResume(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(input, []byte("abc"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stopped after the first byte was read
+	m := newMachine(t, input)
+	m.execute(t, 6)
+	m.ram.SetKey(0x1000, 3)
+
+	s, err := Capture(m.cpu, m.ram, m.devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := s.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	m.execute(t, 40)
+	want := m.ram.GetWord(m.sum)
+	if want != 'a'+'b'+'c' {
+		t.Fatalf("sum %d, want %d", want, 'a'+'b'+'c')
+	}
+
+	s, err = Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := newMachine(t, input)
+	if err := s.Restore(resumed.cpu, resumed.ram, resumed.devices); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.cpu.GetRegister(processor.RegS) != 'a' {
+		t.Errorf("S is %d after the restore, want %d", resumed.cpu.GetRegister(processor.RegS), 'a')
+	}
+	if key := resumed.ram.GetKey(0x1000); key != 3 {
+		t.Errorf("storage key %d, want 3", key)
+	}
+
+	// The file is read on from the saved offset
+	resumed.execute(t, 40)
+	if sum := resumed.ram.GetWord(resumed.sum); sum != want {
+		t.Errorf("resumed sum %d, want %d", sum, want)
+	}
+	for r := 0; r < 9; r++ {
+		if r != processor.RegF && resumed.cpu.GetRegister(r) != m.cpu.GetRegister(r) {
+			t.Errorf("register %d is %d, want %d", r, resumed.cpu.GetRegister(r), m.cpu.GetRegister(r))
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{"SICSNA", "unexpected EOF"},
+		{"SNAPSIC\x00\x02", "Not a snapshot"},
+		{"SICSNAP\x00\x03", "Snapshot version 3 is newer than 2"},
+	}
+
+	for _, test := range tests {
+		if _, err := Read(strings.NewReader(test.data)); err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %s", test.data, err, test.err)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	data := make([]byte, 1000)
+	copy(data[300:], "aaaabcd")
+	data[999] = 0xFF
+
+	packed := compress(data)
+	if len(packed) >= 20 {
+		t.Errorf("%d bytes compressed to %d", len(data), len(packed))
+	}
+	out, err := decompress(packed, len(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Error("decompressed data differs")
+	}
+
+	if _, err := decompress(packed, len(data)-1); err == nil || err.Error() != "Memory too long" {
+		t.Errorf("error %v, want Memory too long", err)
+	}
+	if _, err := decompress(packed, len(data)+1); err == nil || err.Error() != "Memory too short" {
+		t.Errorf("error %v, want Memory too short", err)
+	}
+	if _, err := decompress(packed[:len(packed)-1], len(data)); err == nil || err.Error() != "Invalid run" {
+		t.Errorf("error %v, want Invalid run", err)
+	}
+}
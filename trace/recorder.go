@@ -0,0 +1,102 @@
+package trace
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/uroshercog/sic-machine/disasm"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Recorder writes a record for every instruction the CPU executes
+type Recorder struct {
+	w         *bufio.Writer
+	cpu       *processor.CPU
+	registers Registers
+	// Memory written since the last record, including by interrupts
+	writes []Write
+	step   uint64
+	closed bool
+	err    error
+}
+
+// NewRecorder starts tracing the CPU into w, beginning with its current registers
+func NewRecorder(w io.Writer, cpu *processor.CPU, ram *memory.RAM) (*Recorder, error) {
+	rec := &Recorder{
+		w:   bufio.NewWriter(w),
+		cpu: cpu,
+	}
+
+	rec.registers = rec.read()
+	if err := writeHeader(rec.w, rec.registers); err != nil {
+		return nil, err
+	}
+
+	ram.OnWrite = append(ram.OnWrite, func(addr int32, value byte) {
+		if !rec.closed {
+			rec.writes = append(rec.writes, Write{addr, value})
+		}
+	})
+	cpu.OnExec = append(cpu.OnExec, rec.record)
+
+	return rec, nil
+}
+
+// Reads the registers of the CPU
+func (rec *Recorder) read() Registers {
+	var regs Registers
+	for i := range regs {
+		if i == processor.RegF {
+			regs[i] = rec.cpu.GetFloatBits()
+		} else {
+			regs[i] = uint64(rec.cpu.GetRegister(i)) & 0xFFFFFF
+		}
+	}
+	return regs
+}
+
+func (rec *Recorder) record(inst *disasm.Instruction) {
+	if rec.closed || rec.err != nil {
+		return
+	}
+
+	r := &Record{
+		Step:     rec.step,
+		PC:       inst.Address,
+		Bytes:    inst.Bytes,
+		Mnemonic: inst.Mnemonic,
+		Address:  rec.cpu.EffectiveAddress(),
+		Writes:   rec.writes,
+	}
+
+	regs := rec.read()
+	for i, v := range regs {
+		if v != rec.registers[i] {
+			r.Registers = append(r.Registers, RegisterChange{byte(i), v})
+		}
+	}
+	rec.registers = regs
+
+	rec.err = writeRecord(rec.w, r)
+	rec.writes = nil
+	rec.step++
+}
+
+// Err returns the first error writing the trace
+func (rec *Recorder) Err() error {
+	return rec.err
+}
+
+// Close stops recording and flushes the trace, it does not close the writer
+func (rec *Recorder) Close() error {
+	if rec.closed {
+		return rec.err
+	}
+	rec.closed = true
+
+	if err := rec.w.Flush(); rec.err == nil {
+		rec.err = err
+	}
+	return rec.err
+}
@@ -0,0 +1,127 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+// Format renders a record as a line of text
+func Format(rec *Record) string {
+	var b bytes.Buffer
+
+	addr := "-"
+	if rec.Address >= 0 {
+		addr = fmt.Sprintf("%06X", rec.Address)
+	}
+	fmt.Fprintf(&b, "%8d  %06X  %-8X  %-6s  %-6s", rec.Step, rec.PC, rec.Bytes, rec.Mnemonic, addr)
+
+	for _, c := range rec.Registers {
+		if int(c.Register) == processor.RegF {
+			fmt.Fprintf(&b, "  %s=%012X", registerNames[c.Register], c.Value)
+		} else {
+			fmt.Fprintf(&b, "  %s=%06X", registerNames[c.Register], c.Value)
+		}
+	}
+	for _, w := range rec.Writes {
+		fmt.Fprintf(&b, "  [%06X]=%02X", w.Addr, w.Value)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// Export writes the whole trace as text, one instruction per line
+func Export(w io.Writer, tr *Reader) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%8s  %-6s  %-8s  %-6s  %-6s  %s\n", "Step", "PC", "Bytes", "Inst", "Addr", "Changes")
+
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			bw.Flush()
+			return err
+		}
+		fmt.Fprintln(bw, Format(rec))
+	}
+	return bw.Flush()
+}
+
+// Divergence is the first step at which two traces differ
+type Divergence struct {
+	Step uint64
+	// Records of both traces, nil if the trace ended
+	A, B   *Record
+	Reason string
+}
+
+// Diff compares two traces and returns where they first diverge, nil if they are the same
+func Diff(a, b *Reader) (*Divergence, error) {
+	if a.Registers() != b.Registers() {
+		return &Divergence{Reason: "initial registers differ: " + diffRegisters(a.Registers(), b.Registers())}, nil
+	}
+
+	for step := uint64(0); ; step++ {
+		ra, errA := a.Next()
+		if errA != nil && errA != io.EOF {
+			return nil, errA
+		}
+		rb, errB := b.Next()
+		if errB != nil && errB != io.EOF {
+			return nil, errB
+		}
+
+		switch {
+		case ra == nil && rb == nil:
+			return nil, nil
+		case ra == nil:
+			return &Divergence{Step: step, B: rb, Reason: "first trace ended"}, nil
+		case rb == nil:
+			return &Divergence{Step: step, A: ra, Reason: "second trace ended"}, nil
+		}
+
+		d := &Divergence{Step: step, A: ra, B: rb}
+		switch {
+		case ra.PC != rb.PC:
+			d.Reason = "PC differs"
+		case string(ra.Bytes) != string(rb.Bytes):
+			d.Reason = "instruction differs"
+		case ra.Address != rb.Address:
+			d.Reason = "effective address differs"
+		case a.Registers() != b.Registers():
+			d.Reason = "registers differ: " + diffRegisters(a.Registers(), b.Registers())
+		case !sameWrites(ra.Writes, rb.Writes):
+			d.Reason = "memory writes differ"
+		default:
+			continue
+		}
+		return d, nil
+	}
+}
+
+func diffRegisters(a, b Registers) string {
+	var diffs []string
+	for i := range a {
+		if a[i] != b[i] {
+			diffs = append(diffs, fmt.Sprintf("%s %X != %X", registerNames[i], a[i], b[i]))
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+func sameWrites(a, b []Write) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
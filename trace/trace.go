@@ -0,0 +1,219 @@
+// Package trace records every instruction a CPU executes into a compact
+// binary file that can be replayed, exported as text and compared.
+//
+// A trace starts with the magic, the version and the value of every register
+// before the first instruction. Each record then holds:
+//
+//	uvarint   PC
+//	byte      number of instruction bytes, followed by the bytes
+//	byte      length of the mnemonic, followed by the mnemonic
+//	varint    effective address, -1 if the instruction has none
+//	byte      number of changed registers, each as a byte index and an uvarint value
+//	uvarint   number of memory writes, each as an uvarint address and the byte written
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version of the format
+const Version = 1
+
+var magic = []byte("SICTRACE")
+
+// Number of registers in a trace, in the order of the processor register indices
+const registerCount = 9
+
+var registerNames = []string{"A", "X", "L", "B", "S", "T", "F", "PC", "SW"}
+
+// RegisterChange is the new value of a register, F is in its 48-bit representation
+type RegisterChange struct {
+	Register byte
+	Value    uint64
+}
+
+// Write is a byte written to the memory
+type Write struct {
+	Addr  int32
+	Value byte
+}
+
+// Record describes a single executed instruction
+type Record struct {
+	Step      uint64
+	PC        int32
+	Bytes     []byte
+	Mnemonic  string
+	Address   int32
+	Registers []RegisterChange
+	Writes    []Write
+}
+
+// Registers is the value of every register
+type Registers [registerCount]uint64
+
+func writeHeader(w *bufio.Writer, regs Registers) error {
+	w.Write(magic)
+	w.WriteByte(Version)
+	for _, v := range regs {
+		writeUvarint(w, v)
+	}
+	return w.Flush()
+}
+
+func writeRecord(w *bufio.Writer, rec *Record) error {
+	writeUvarint(w, uint64(rec.PC))
+
+	w.WriteByte(byte(len(rec.Bytes)))
+	w.Write(rec.Bytes)
+
+	w.WriteByte(byte(len(rec.Mnemonic)))
+	w.WriteString(rec.Mnemonic)
+
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], int64(rec.Address))
+	w.Write(buf[:n])
+
+	w.WriteByte(byte(len(rec.Registers)))
+	for _, c := range rec.Registers {
+		w.WriteByte(c.Register)
+		writeUvarint(w, c.Value)
+	}
+
+	writeUvarint(w, uint64(len(rec.Writes)))
+	for _, wr := range rec.Writes {
+		writeUvarint(w, uint64(wr.Addr))
+		if err := w.WriteByte(wr.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeUvarint(w *bufio.Writer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+// Reader reads a trace and keeps track of the registers
+type Reader struct {
+	r         *bufio.Reader
+	registers Registers
+	step      uint64
+}
+
+// NewReader reads the header of a trace
+func NewReader(r io.Reader) (*Reader, error) {
+	tr := &Reader{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(tr.r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:len(magic)]) != string(magic) {
+		return nil, errors.New("Not a trace")
+	}
+	if header[len(magic)] > Version {
+		return nil, fmt.Errorf("Trace version %d is newer than %d", header[len(magic)], Version)
+	}
+
+	for i := range tr.registers {
+		v, err := binary.ReadUvarint(tr.r)
+		if err != nil {
+			return nil, err
+		}
+		tr.registers[i] = v
+	}
+	return tr, nil
+}
+
+// Registers returns the registers after the last record that was read
+func (tr *Reader) Registers() Registers {
+	return tr.registers
+}
+
+// Next reads the next record, it returns io.EOF at the end of the trace
+func (tr *Reader) Next() (*Record, error) {
+	pc, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &Record{Step: tr.step, PC: int32(pc)}
+	if rec.Bytes, err = tr.readBytes(); err != nil {
+		return nil, unexpected(err)
+	}
+	mnemonic, err := tr.readBytes()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	rec.Mnemonic = string(mnemonic)
+
+	addr, err := binary.ReadVarint(tr.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	rec.Address = int32(addr)
+
+	count, err := tr.r.ReadByte()
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	for i := 0; i < int(count); i++ {
+		r, err := tr.r.ReadByte()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if int(r) >= registerCount {
+			return nil, fmt.Errorf("Invalid register %d at step %d", r, tr.step)
+		}
+		v, err := binary.ReadUvarint(tr.r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		rec.Registers = append(rec.Registers, RegisterChange{r, v})
+		tr.registers[r] = v
+	}
+
+	writes, err := binary.ReadUvarint(tr.r)
+	if err != nil {
+		return nil, unexpected(err)
+	}
+	for i := uint64(0); i < writes; i++ {
+		addr, err := binary.ReadUvarint(tr.r)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		value, err := tr.r.ReadByte()
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		rec.Writes = append(rec.Writes, Write{int32(addr), value})
+	}
+
+	tr.step++
+	return rec, nil
+}
+
+func (tr *Reader) readBytes() ([]byte, error) {
+	n, err := tr.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	_, err = io.ReadFull(tr.r, data)
+	return data, err
+}
+
+// A record that ends early is a truncated trace
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/uroshercog/sic-machine/asm"
+	dev "github.com/uroshercog/sic-machine/devices"
+	"github.com/uroshercog/sic-machine/memory"
+	"github.com/uroshercog/sic-machine/obj"
+	"github.com/uroshercog/sic-machine/processor"
+)
+
+const source = `PROG    START   0
+        LDA     #%d
+        STA     VALUE
+HALT    J       HALT
+VALUE   WORD    0
+        END     PROG
+`
+
+// Traces the first n instructions of the program that stores value
+func record(t *testing.T, value string, n int) []byte {
+	t.Helper()
+	program, err := asm.Assemble(strings.NewReader(strings.Replace(source, "%d", value, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	program.WriteObject(&buf)
+	sections, err := obj.Parse(&buf, "trace.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ram := memory.New()
+	ram.Load(sections[0])
+	cpu := processor.NewCPU(ram, dev.New())
+	cpu.SetStart(program.Entry)
+	cpu.SetRegister(processor.RegX, 0x123)
+
+	var out bytes.Buffer
+	rec, err := NewRecorder(&out, cpu, ram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := cpu.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func TestRecord(t *testing.T) {
+	tr, err := NewReader(bytes.NewReader(record(t, "5", 3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := tr.Registers()[processor.RegX]; x != 0x123 {
+		t.Errorf("initial X %X, want 123", x)
+	}
+
+	want := []string{
+		"       0  000000  010005    LDA     000005  A=000005  PC=000003",
+		"       1  000003  0F2003    STA     000009  PC=000006  [000009]=00  [00000A]=00  [00000B]=05",
+		"       2  000006  3F2FFD    J       000006",
+	}
+	for i, line := range want {
+		rec, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Format(rec); got != line {
+			t.Errorf("record %d\n got %q\nwant %q", i, got, line)
+		}
+	}
+	if a := tr.Registers()[processor.RegA]; a != 5 {
+		t.Errorf("A %X at the end", a)
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("error %v after the last record, want EOF", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	tr, err := NewReader(bytes.NewReader(record(t, "5", 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := Export(&out, tr); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(strings.TrimSpace(lines[0]), "Step") {
+		t.Errorf("exported\n%s", out.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diff := func(a, b []byte) *Divergence {
+		t.Helper()
+		ra, err := NewReader(bytes.NewReader(a))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rb, err := NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := Diff(ra, rb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	if d := diff(record(t, "5", 3), record(t, "5", 3)); d != nil {
+		t.Errorf("same traces diverge at %d: %s", d.Step, d.Reason)
+	}
+
+	// The loaded value differs in the instruction bytes first
+	if d := diff(record(t, "5", 3), record(t, "6", 3)); d == nil || d.Step != 0 || d.Reason != "instruction differs" {
+		t.Errorf("divergence %+v, want instruction differs at 0", d)
+	}
+
+	if d := diff(record(t, "5", 3), record(t, "5", 2)); d == nil || d.Step != 2 || d.Reason != "second trace ended" || d.A == nil || d.B != nil {
+		t.Errorf("divergence %+v, want second trace ended at 2", d)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{"SICTRACX\x01", "Not a trace"},
+		{"SICTRACE\x02", "Trace version 2 is newer than 1"},
+	}
+	for _, test := range tests {
+		data := test.data + strings.Repeat("\x00", registerCount)
+		if _, err := NewReader(strings.NewReader(data)); err == nil || err.Error() != test.err {
+			t.Errorf("%q: error %v, want %s", test.data, err, test.err)
+		}
+	}
+
+	// A record cut short
+	data := record(t, "5", 1)
+	tr, err := NewReader(bytes.NewReader(data[:len(data)-2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tr.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("error %v for a truncated record, want unexpected EOF", err)
+	}
+}
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/gizak/termui"
+)
+
+const (
+	// Any key, more specific handlers take precedence
+	anyKey = "/sys/kbd"
+	// Focuses the console or leaves it
+	focusKey  = "/sys/kbd/<tab>"
+	escapeKey = "/sys/kbd/<escape>"
+)
+
+// Number of typed lines the console shows
+const consoleLines = 4
+
+// Keys that are typed as something else than their name
+var typedKeys = map[string]byte{
+	"<enter>": '\n',
+	"<space>": ' ',
+}
+
+func (ui *UI) handleConsole() {
+	termui.Handle(focusKey, func(termui.Event) {
+		ui.focused = !ui.focused
+		ui.RenderConsoleWidget()
+	})
+	termui.Handle(escapeKey, func(termui.Event) {
+		ui.focused = false
+		ui.RenderConsoleWidget()
+	})
+	termui.Handle(anyKey, func(e termui.Event) {
+		if ui.focused {
+			ui.typeKey(e)
+		}
+	})
+}
+
+// Types the key of the event into the console, keys that are not characters are ignored
+func (ui *UI) typeKey(e termui.Event) {
+	kbd, ok := e.Data.(termui.EvtKbd)
+	if !ok {
+		return
+	}
+
+	value, ok := typedKeys[kbd.KeyStr]
+	if !ok {
+		if len(kbd.KeyStr) != 1 {
+			return
+		}
+		value = kbd.KeyStr[0]
+	}
+
+	ui.typed = append(ui.typed, value)
+	ui.RenderConsoleWidget()
+	for _, f := range ui.OnType {
+		f(value)
+	}
+}
+
+func (ui *UI) RenderConsoleWidget() {
+	lines := strings.Split(string(ui.typed), "\n")
+	if len(lines) > consoleLines {
+		lines = lines[len(lines)-consoleLines:]
+	}
+
+	st := termui.NewPar(strings.Join(lines, "\n"))
+	st.Height = 2 + consoleLines
+	st.Width = 30
+	st.Y = 25 + len(instructions)
+	st.BorderLabel = "Console"
+	if ui.focused {
+		st.BorderLabel = "Console [typing]"
+	}
+	termui.Render(st)
+}
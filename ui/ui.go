@@ -2,6 +2,7 @@ package ui
 
 import (
 	"github.com/gizak/termui"
+	"github.com/uroshercog/sic-machine/disasm"
 	"fmt"
 	"strings"
 )
@@ -13,6 +14,10 @@ const (
 	CONTINUE = UIEvent("/sys/kbd/o")
 	STEP     = UIEvent("/sys/kbd/s")
 	QUIT     = UIEvent("/sys/kbd/q")
+	BACK     = UIEvent("/sys/kbd/b")
+	REVERSE  = UIEvent("/sys/kbd/r")
+	SAVE     = UIEvent("/sys/kbd/w")
+	LOAD     = UIEvent("/sys/kbd/l")
 )
 
 var (
@@ -20,11 +25,23 @@ var (
 		"[s] Step",
 		"[p] Pause execution",
 		"[o] Continue execution",
+		"[b] Step back",
+		"[r] Reverse continue",
+		"[w] Save the state",
+		"[l] Load the state",
+		"[tab] Type into the console",
 		"[q] Close the VM",
 	}
 )
 
-type UI struct{}
+type UI struct {
+	// Called with every key typed into the console
+	OnType []func(value byte)
+
+	// Keys go to the console instead of the handlers while it is focused
+	focused bool
+	typed   []byte
+}
 
 func (ui *UI) Run(ram []byte, registers []string) {
 	if err := termui.Init(); err != nil {
@@ -36,19 +53,27 @@ func (ui *UI) Run(ram []byte, registers []string) {
 	ui.Handle(QUIT, func() {
 		termui.StopLoop()
 	})
+	ui.handleConsole()
 
 	ui.RenderRegistersWidget(registers)
 	ui.RenderStatusWidget("initialized")
 	ui.RenderInstructionsWidget()
 	ui.RenderRAMWidget(ram)
 	ui.RenderScreenWidget(ram)
-	ui.RenderExecutingCommand("")
+	ui.RenderExecutingCommand(nil)
+	ui.RenderConsoleWidget()
 
 	termui.Loop()
 }
 
 func (ui *UI) Handle(ev UIEvent, f func()) {
-	termui.Handle(string(ev), func(termui.Event) { f() })
+	termui.Handle(string(ev), func(e termui.Event) {
+		if ui.focused {
+			ui.typeKey(e)
+			return
+		}
+		f()
+	})
 }
 
 func (ui *UI) RenderRAMWidget(ram []byte) {
@@ -149,7 +174,12 @@ func (ui *UI) RenderInstructionsWidget() {
 
 	termui.Render(ls)
 }
-func (ui *UI) RenderExecutingCommand(cmd string) {
+func (ui *UI) RenderExecutingCommand(inst *disasm.Instruction) {
+	cmd := ""
+	if inst != nil {
+		cmd = fmt.Sprintf("%06X %s", inst.Address, inst)
+	}
+
 	st := termui.NewPar(cmd)
 	st.Height = 3
 	st.Width = 30
@@ -157,3 +187,14 @@ func (ui *UI) RenderExecutingCommand(cmd string) {
 	st.BorderLabel = "Last executed"
 	termui.Render(st)
 }
+func (ui *UI) RenderFaultWidget(lines []string) {
+	ls := termui.NewList()
+	ls.Items = lines
+	ls.ItemFgColor = termui.ColorRed
+	ls.BorderLabel = "Fault"
+	ls.Height = 6
+	ls.Width = 30
+	ls.Y = 19 + len(instructions)
+
+	termui.Render(ls)
+}